@@ -1,22 +1,27 @@
 module github.com/crikke/oi
 
-go 1.18
+go 1.22
+
+require (
+	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v1.0.0
+	github.com/google/uuid v1.3.0
+	github.com/klauspost/compress v1.18.0
+	github.com/spaolacci/murmur3 v1.1.0
+	github.com/stretchr/testify v1.8.0
+	go.uber.org/zap v1.22.0
+	google.golang.org/grpc v1.48.0
+	google.golang.org/protobuf v1.27.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/google/uuid v1.3.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/spaolacci/murmur3 v1.1.0 // indirect
-	github.com/stretchr/testify v1.8.0 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.8.0 // indirect
-	go.uber.org/zap v1.22.0 // indirect
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
 	golang.org/x/sys v0.0.0-20210119212857-b64e53b001e4 // indirect
 	golang.org/x/text v0.3.3 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
-	google.golang.org/grpc v1.48.0 // indirect
-	google.golang.org/protobuf v1.27.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
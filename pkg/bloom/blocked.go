@@ -0,0 +1,100 @@
+package bloom
+
+import (
+	"encoding/binary"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// Blocked bloom filter
+//
+// A BloomFilter sets k bits at random positions of the bitarray, so a lookup touches up to k cache lines.
+// A blocked bloom filter splits the bitarray into blocks of one cache line, 512 bits, and sets all k bits of a key
+// within a single block. A lookup then reads one cache line, and the bits of the block are tested word by word.
+//
+// A single 128 bit murmur3 hash is computed per key. The low 64 bits select the block, and the k bits within the block
+// are derived from the high 64 bits with double hashing:
+//
+//	bit(i) = h1 + i*h2 mod 512
+//
+// Since the keys are not spread evenly between the blocks, the false positive rate is slightly higher than for
+// a BloomFilter of the same size.
+
+const (
+	// bits of a block, a cache line of 64 bytes
+	blockBits     = 512
+	wordsPerBlock = blockBits / 64
+)
+
+type BlockedBloomFilter struct {
+	// numbers of bits set per key
+	k uint32
+	// number of blocks of the bitarray
+	blocks uint32
+	// the bitarray, every block is wordsPerBlock consecutive words
+	words []uint64
+
+	// items in filter
+	n uint32
+}
+
+// NewBlockedBloomFilter returns a blocked bloom filter sized for the false positive rate and the expected number of items,
+// the size is rounded up to whole blocks.
+func NewBlockedBloomFilter(falsePositiveRate float64, expectedItemCount int) (*BlockedBloomFilter, error) {
+
+	if expectedItemCount < 1 {
+		expectedItemCount = 1
+	}
+	k, m := calculate_K_M(falsePositiveRate, expectedItemCount)
+
+	blocks := (m + blockBits - 1) / blockBits
+	return &BlockedBloomFilter{
+		k:      k,
+		blocks: blocks,
+		words:  make([]uint64, blocks*wordsPerBlock),
+	}, nil
+}
+
+// probe returns the block of the key and the hashes used to derive its bits
+func (b *BlockedBloomFilter) probe(key []byte) ([]uint64, uint32, uint32) {
+
+	lo, hi := murmur3.Sum128(key)
+
+	i := lo % uint64(b.blocks) * wordsPerBlock
+	// an odd step visits distinct bits of the block
+	return b.words[i : i+wordsPerBlock], uint32(hi), uint32(hi>>32) | 1
+}
+
+func (b *BlockedBloomFilter) Insert(key []byte) {
+
+	block, h1, h2 := b.probe(key)
+	for i := uint32(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % blockBits
+		block[bit/64] |= 1 << (bit % 64)
+	}
+	b.n++
+}
+
+func (b *BlockedBloomFilter) Exists(key []byte) bool {
+
+	block, h1, h2 := b.probe(key)
+	for i := uint32(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % blockBits
+		if block[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Save the filter.
+//
+// If file exists it will be overwritten.
+func (b *BlockedBloomFilter) Save(path string) error {
+
+	arr := make([]byte, len(b.words)*8)
+	for i, w := range b.words {
+		binary.LittleEndian.PutUint64(arr[i*8:], w)
+	}
+	return save(path, header{filterType: blockedFilter, k: b.k, m: b.blocks * blockBits, n: b.n}, arr)
+}
@@ -1,9 +1,7 @@
 package bloom
 
 import (
-	"encoding/binary"
 	"math"
-	"os"
 
 	"github.com/spaolacci/murmur3"
 )
@@ -36,14 +34,21 @@ import (
 //
 //	k = ln(2) * m/n
 
+// Filter is a set of keys which may report that a key exists even though it was never inserted,
+// but never reports that an inserted key does not exist.
+type Filter interface {
+	Insert(key []byte)
+	Exists(key []byte) bool
+	// Save the filter to path, see Open
+	Save(path string) error
+}
+
 type BloomFilter struct {
-	// filePath to the file on disk containing the bitarray
-	filePath string
 	// the size of the bitarray. A longer array will lead to less false positives
 	m uint32
 	// numbers of hash functions
 	k uint32
-	// the actual bitarray. Size is math.Round((m + 4) / 8)
+	// the actual bitarray. Size is (m + 7) / 8
 	arr []byte
 
 	// items in filter
@@ -52,6 +57,9 @@ type BloomFilter struct {
 
 func NewBloomFilter(falsePositiveRate float64, expectedItemCount int) (*BloomFilter, error) {
 
+	if expectedItemCount < 1 {
+		expectedItemCount = 1
+	}
 	k, m := calculate_K_M(falsePositiveRate, expectedItemCount)
 
 	b := &BloomFilter{
@@ -59,14 +67,14 @@ func NewBloomFilter(falsePositiveRate float64, expectedItemCount int) (*BloomFil
 		m: m,
 	}
 
-	b.arr = make([]byte, int(math.Round(float64(m)+4)/8))
+	b.arr = make([]byte, arraySize(m))
 
 	return b, nil
 }
 
 func (b *BloomFilter) Insert(key []byte) {
 
-	for i := uint32(0); i > b.k; i++ {
+	for i := uint32(0); i < b.k; i++ {
 		h := murmur3.Sum64WithSeed(key, uint32(i)) % uint64(b.m)
 
 		// divide h with 8 to get the byte
@@ -83,7 +91,7 @@ func (b *BloomFilter) Insert(key []byte) {
 
 func (b BloomFilter) Exists(key []byte) bool {
 
-	for i := uint32(0); i > b.k; i++ {
+	for i := uint32(0); i < b.k; i++ {
 		h := murmur3.Sum64WithSeed(key, uint32(i)) % uint64(b.m)
 
 		// divide h with 8 to get the byte
@@ -103,6 +111,9 @@ func (b BloomFilter) Exists(key []byte) bool {
 	return true
 }
 
+// maxK is the maximum number of bits set per key, reached at a false positive rate of about 1e-19
+const maxK = 64
+
 func calculate_K_M(p float64, n int) (uint32, uint32) {
 
 	// formula for calculating m:
@@ -114,72 +125,17 @@ func calculate_K_M(p float64, n int) (uint32, uint32) {
 	k := (float64(m) / float64(n) * math.Ln2)
 
 	// round up to nearest integer
-	return uint32(math.Round(k + 0.5)), uint32(math.Round(m + 0.5))
+	return uint32(math.Min(math.Round(k+0.5), maxK)), uint32(math.Round(m + 0.5))
 }
 
 // Save the bloomfilter.
 //
 // If file exists it will be overwritten.
 func (b BloomFilter) Save(path string) error {
-
-	buf := make([]byte, 12)
-
-	binary.LittleEndian.PutUint32(buf[0:4], b.k)
-	binary.LittleEndian.PutUint32(buf[4:8], b.m)
-	binary.LittleEndian.PutUint32(buf[8:12], b.n)
-
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0660)
-
-	if err != nil {
-		return err
-	}
-	_, err = f.Write(buf)
-	if err != nil {
-		return err
-	}
-
-	_, err = f.Write(b.arr)
-
-	if err != nil {
-		return err
-	}
-	return nil
+	return save(path, header{filterType: standardFilter, k: b.k, m: b.m, n: b.n}, b.arr)
 }
 
-// TODO: Having a open function that both opens and closes
-// a file is wrong but works for now.
-func Open(path string) (BloomFilter, error) {
-	f, err := os.Open(path)
-
-	if err != nil {
-		return BloomFilter{}, err
-	}
-
-	buf := make([]byte, 12)
-	_, err = f.Read(buf)
-
-	if err != nil {
-		return BloomFilter{}, err
-	}
-
-	b := BloomFilter{}
-
-	b.k = uint32(binary.LittleEndian.Uint32(buf[0:4]))
-	b.m = uint32(binary.LittleEndian.Uint32(buf[4:8]))
-	b.n = uint32(binary.LittleEndian.Uint32(buf[8:12]))
-
-	arr := make([]byte, int(math.Round(float64(b.m)+4)/8))
-
-	_, err = f.Read(arr)
-
-	if err != nil {
-		return BloomFilter{}, err
-	}
-
-	b.arr = arr
-
-	if err = f.Close(); err != nil {
-		return BloomFilter{}, err
-	}
-	return b, nil
+// returns the number of bytes needed to store a bitarray of m bits
+func arraySize(m uint32) int {
+	return int((m + 7) / 8)
 }
@@ -0,0 +1,135 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilters(t testing.TB, n int) map[string]Filter {
+
+	standard, err := NewBloomFilter(0.01, n)
+	assert.NoError(t, err)
+
+	blocked, err := NewBlockedBloomFilter(0.01, n)
+	assert.NoError(t, err)
+
+	return map[string]Filter{"standard": standard, "blocked": blocked}
+}
+
+func TestFilters(t *testing.T) {
+
+	for name, f := range newFilters(t, 10000) {
+		t.Run(name, func(t *testing.T) {
+
+			path := fmt.Sprintf("/tmp/%s", uuid.NewString())
+			defer os.Remove(path)
+
+			for i := 0; i < 10000; i++ {
+				f.Insert([]byte(fmt.Sprintf("key%d", i)))
+			}
+			assert.NoError(t, f.Save(path))
+
+			opened, err := Open(path)
+			assert.NoError(t, err)
+			assert.IsType(t, f, opened)
+
+			for i := 0; i < 10000; i++ {
+				assert.True(t, opened.Exists([]byte(fmt.Sprintf("key%d", i))))
+			}
+
+			falsePositives := 0
+			for i := 0; i < 10000; i++ {
+				if opened.Exists([]byte(fmt.Sprintf("other%d", i))) {
+					falsePositives++
+				}
+			}
+			assert.Less(t, falsePositives, 300)
+		})
+	}
+}
+
+func TestOpenLegacyFilter(t *testing.T) {
+
+	path := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.Remove(path)
+
+	b, err := NewBloomFilter(0.01, 100)
+	assert.NoError(t, err)
+	b.Insert([]byte("key"))
+
+	// filters saved before the header was versioned start with k, m and n
+	buf := make([]byte, 12)
+	binary.LittleEndian.PutUint32(buf[0:4], b.k)
+	binary.LittleEndian.PutUint32(buf[4:8], b.m)
+	binary.LittleEndian.PutUint32(buf[8:12], b.n)
+	assert.NoError(t, os.WriteFile(path, append(buf, b.arr...), 0660))
+
+	opened, err := Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, b, opened)
+}
+
+func TestOpenCorruptFilter(t *testing.T) {
+
+	for name, h := range map[string]header{
+		"standard zero bits":   {filterType: standardFilter, k: 7, m: 0},
+		"blocked zero bits":    {filterType: blockedFilter, k: 7, m: 0},
+		"zero hashes":          {filterType: blockedFilter, k: 0, m: blockBits},
+		"out of range hashes":  {filterType: standardFilter, k: 1 << 30, m: 1024},
+		"partial blocked bits": {filterType: blockedFilter, k: 7, m: blockBits + 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			path := fmt.Sprintf("/tmp/%s", uuid.NewString())
+			defer os.Remove(path)
+
+			assert.NoError(t, save(path, h, make([]byte, arraySize(h.m))))
+
+			_, err := Open(path)
+			assert.ErrorIs(t, err, ErrCorruptFilter)
+		})
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+
+	keys := benchmarkKeys(1 << 16)
+	for name, f := range newFilters(b, len(keys)) {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.Insert(keys[i%len(keys)])
+			}
+		})
+	}
+}
+
+func BenchmarkExists(b *testing.B) {
+
+	// large enough that the filters do not fit in the cpu caches
+	keys := benchmarkKeys(1 << 20)
+	for name, f := range newFilters(b, len(keys)) {
+		for _, key := range keys {
+			f.Insert(key)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.Exists(keys[(i*7919)%len(keys)])
+			}
+		})
+	}
+}
+
+func benchmarkKeys(n int) [][]byte {
+
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%08d", i))
+	}
+	return keys
+}
@@ -0,0 +1,153 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// On disk format
+//
+// A filter is stored as a header followed by its bitarray.
+//
+//	[magic: 4 bytes] [version: 4 bytes] [type: 4 bytes] [k: 4 bytes] [m: 4 bytes] [n: 4 bytes] [bitarray]
+//
+// All integers are little endian. m is the number of bits of the bitarray.
+//
+// Filters saved before the header was versioned start directly with k, m and n and are always a BloomFilter.
+// The magic can not be mistaken for k, since k is never that large.
+
+const (
+	// filterMagic identifies a versioned filter
+	filterMagic = 0x46424f49 // "OIBF"
+	// filterFormatVersion is the version of the format written
+	filterFormatVersion = 1
+
+	headerSize       = 24
+	legacyHeaderSize = 12
+)
+
+// ErrCorruptFilter is returned when opening a filter whose header is invalid
+var ErrCorruptFilter = errors.New("corrupt filter")
+
+type filterType uint32
+
+const (
+	standardFilter filterType = iota
+	blockedFilter
+)
+
+type header struct {
+	filterType filterType
+	k          uint32
+	m          uint32
+	n          uint32
+}
+
+func save(path string, h header, arr []byte) error {
+
+	buf := make([]byte, headerSize, headerSize+len(arr))
+	binary.LittleEndian.PutUint32(buf[0:4], filterMagic)
+	binary.LittleEndian.PutUint32(buf[4:8], filterFormatVersion)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(h.filterType))
+	binary.LittleEndian.PutUint32(buf[12:16], h.k)
+	binary.LittleEndian.PutUint32(buf[16:20], h.m)
+	binary.LittleEndian.PutUint32(buf[20:24], h.n)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(buf, arr...)); err != nil {
+		f.Close()
+		return err
+	}
+
+	// the commitlog segments of the SSTable are removed once it is flushed, so the filter must be durable
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Open reads the filter saved at path, either a BloomFilter or a BlockedBloomFilter.
+func Open(path string) (Filter, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h, err := readHeader(f)
+	if err != nil {
+		return nil, fmt.Errorf("[Open] error reading %s: %w", path, err)
+	}
+
+	// the filter would divide by zero or hash a key an unbounded number of times
+	if h.m == 0 || h.k == 0 || h.k > maxK {
+		return nil, fmt.Errorf("[Open] invalid filter %s, k: %d, m: %d: %w", path, h.k, h.m, ErrCorruptFilter)
+	}
+
+	switch h.filterType {
+	case standardFilter:
+		arr := make([]byte, arraySize(h.m))
+		if _, err := io.ReadFull(f, arr); err != nil {
+			return nil, err
+		}
+		return &BloomFilter{k: h.k, m: h.m, n: h.n, arr: arr}, nil
+
+	case blockedFilter:
+		if h.m%blockBits != 0 {
+			return nil, fmt.Errorf("[Open] invalid blocked filter %s: %d bits: %w", path, h.m, ErrCorruptFilter)
+		}
+
+		arr := make([]byte, h.m/8)
+		if _, err := io.ReadFull(f, arr); err != nil {
+			return nil, err
+		}
+
+		b := &BlockedBloomFilter{k: h.k, blocks: h.m / blockBits, n: h.n, words: make([]uint64, len(arr)/8)}
+		for i := range b.words {
+			b.words[i] = binary.LittleEndian.Uint64(arr[i*8:])
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("[Open] unknown filter type %d in %s", h.filterType, path)
+}
+
+func readHeader(r io.Reader) (header, error) {
+
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf[:legacyHeaderSize]); err != nil {
+		return header{}, err
+	}
+
+	if binary.LittleEndian.Uint32(buf[0:4]) != filterMagic {
+		return header{
+			filterType: standardFilter,
+			k:          binary.LittleEndian.Uint32(buf[0:4]),
+			m:          binary.LittleEndian.Uint32(buf[4:8]),
+			n:          binary.LittleEndian.Uint32(buf[8:12]),
+		}, nil
+	}
+
+	if _, err := io.ReadFull(r, buf[legacyHeaderSize:]); err != nil {
+		return header{}, err
+	}
+
+	if v := binary.LittleEndian.Uint32(buf[4:8]); v != filterFormatVersion {
+		return header{}, fmt.Errorf("unsupported filter format version %d", v)
+	}
+
+	return header{
+		filterType: filterType(binary.LittleEndian.Uint32(buf[8:12])),
+		k:          binary.LittleEndian.Uint32(buf[12:16]),
+		m:          binary.LittleEndian.Uint32(buf[16:20]),
+		n:          binary.LittleEndian.Uint32(buf[20:24]),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package commitlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Archiver stores sealed segments before they are removed from the log directory.
+// The archived segments are replayed to restore a database to a point in time.
+type Archiver interface {
+	// Archive copies the segment at path to the archive. Archiving a segment twice overwrites the previous copy.
+	Archive(path string) error
+	// Segments returns the names of the archived segments ordered by segment number
+	Segments() ([]string, error)
+	// Open returns the content of an archived segment
+	Open(name string) (io.ReadCloser, error)
+}
+
+// LocalArchiver archives segments to a directory
+type LocalArchiver struct {
+	dir string
+}
+
+func NewLocalArchiver(dir string) (*LocalArchiver, error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("[NewLocalArchiver] fatal: %w", err)
+	}
+	return &LocalArchiver{dir: dir}, nil
+}
+
+// Archive copies the segment to a temporary file which is renamed once it is durable,
+// so the archive never contains a partially copied segment.
+func (a *LocalArchiver) Archive(path string) error {
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+	defer src.Close()
+
+	name := filepath.Base(path)
+	tmp := filepath.Join(a.dir, "tmp_"+name)
+
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+	if err != nil {
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(a.dir, name)); err != nil {
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+
+	dir, err := os.Open(a.dir)
+	if err != nil {
+		return fmt.Errorf("[Archive] fatal: %w", err)
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+func (a *LocalArchiver) Segments() ([]string, error) {
+
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return nil, fmt.Errorf("[Segments] fatal: %w", err)
+	}
+
+	res := make([]string, 0)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), LogPrefix) || !strings.HasSuffix(entry.Name(), LogSuffix) {
+			continue
+		}
+		res = append(res, entry.Name())
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, _ := ParseSegmentName(res[i])
+		b, _ := ParseSegmentName(res[j])
+		return a < b
+	})
+	return res, nil
+}
+
+func (a *LocalArchiver) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(a.dir, filepath.Base(name)))
+}
@@ -0,0 +1,158 @@
+package commitlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/crikke/oi/pkg/data"
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// SegmentReader reads the records of a segment one at a time and verifies their checksums.
+//
+//	reader := NewSegmentReader(f, lsn)
+//	for reader.Next() {
+//		record := reader.Record()
+//	}
+//	if err := reader.Err(); err != nil {
+//	}
+type SegmentReader struct {
+	r    *bufio.Reader
+	name string
+	// records with a LSN below start are skipped
+	start uint64
+
+	record *pb.Record
+	// offset of the current record
+	recordOffset int64
+	// offset of the next record
+	offset int64
+	done   bool
+	err    error
+}
+
+// NewSegmentReader returns a reader which starts at the first record with a LSN greater than or equal to start.
+func NewSegmentReader(r io.Reader, start uint64) *SegmentReader {
+
+	name := ""
+	if f, ok := r.(interface{ Name() string }); ok {
+		name = filepath.Base(f.Name())
+	}
+
+	return &SegmentReader{
+		r:     bufio.NewReader(r),
+		name:  name,
+		start: start,
+	}
+}
+
+// Next advances to the next record. It returns false at the end of the segment or if an error occurred.
+//
+// If a record is corrupt, Err returns a *CorruptionError and Offset is the end of the last intact record.
+func (s *SegmentReader) Next() bool {
+
+	if s.done {
+		return false
+	}
+
+	for {
+		pe := &data.ProtoEntry{}
+		n, err := pe.ReadFrom(s.r)
+		if err != nil {
+
+			s.done = true
+			if errors.Is(err, io.EOF) {
+				return false
+			}
+
+			// the entry ends beyond the end of the segment
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				s.err = s.corruption(pe, n, err)
+				return false
+			}
+			s.err = fmt.Errorf("[SegmentReader] fatal: %w", err)
+			return false
+		}
+
+		record, err := decodeRecord(pe.Data)
+		if err != nil {
+			s.done = true
+			s.err = s.corruption(pe, n, err)
+			return false
+		}
+
+		s.recordOffset = s.offset
+		s.offset += n
+
+		if record.LSN < s.start {
+			continue
+		}
+
+		s.record = record
+		return true
+	}
+}
+
+// Record returns the current record
+func (s *SegmentReader) Record() *pb.Record {
+	return s.record
+}
+
+// Offset returns the offset of the current record within the segment,
+// or the end of the last intact record once Next has returned false.
+func (s *SegmentReader) Offset() int64 {
+	if s.done {
+		return s.offset
+	}
+	return s.recordOffset
+}
+
+// Err returns the error which stopped the reader, if any
+func (s *SegmentReader) Err() error {
+	return s.err
+}
+
+// corruption returns the error of the corrupt entry at the current offset, n is the number of bytes read of the entry.
+//
+// The corruption is at the tail if no intact record follows the start of the entry. This is the case when the server
+// crashed while writing the record. Otherwise the records after the corrupt entry would be lost if the segment was truncated.
+func (s *SegmentReader) corruption(pe *data.ProtoEntry, n int64, err error) error {
+
+	rest, rerr := io.ReadAll(s.r)
+	if rerr != nil {
+		return fmt.Errorf("[SegmentReader] fatal: %w", rerr)
+	}
+
+	// the length prefix was read if the entry is at least 4 bytes
+	consumed := make([]byte, 0, int(n)+len(rest))
+	if n >= 4 {
+		consumed = binary.LittleEndian.AppendUint32(consumed, pe.DataLen)
+		consumed = append(consumed, pe.Data...)
+	}
+	remaining := append(consumed, rest...)
+
+	tail := true
+	for i := 1; i+4 <= len(remaining); i++ {
+		if intactRecordAt(remaining[i:]) {
+			tail = false
+			break
+		}
+	}
+	return &CorruptionError{Segment: s.name, Offset: s.offset, Tail: tail, Err: err}
+}
+
+// intactRecordAt reports if b starts with a length prefixed record with a valid checksum
+func intactRecordAt(b []byte) bool {
+
+	l := int(binary.LittleEndian.Uint32(b[0:4]))
+	if l == 0 || l > len(b)-4 {
+		return false
+	}
+
+	_, err := decodeRecord(b[4 : 4+l])
+	return err == nil
+}
@@ -0,0 +1,53 @@
+package commitlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentReader(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := NewWriter(ctx, dir, Configuration{SegmentSize: 1024}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, w.Write(&pb.Mutation{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte("value")}))
+	}
+
+	f, err := os.Open(filepath.Join(dir, segmentName(firstSegment)))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+
+	start := uint64(firstSegment)<<32 | 2
+	reader := NewSegmentReader(f, start)
+
+	lsns := []uint64{}
+	offset := int64(0)
+	for reader.Next() {
+		assert.Greater(t, reader.Offset(), offset)
+		offset = reader.Offset()
+		lsns = append(lsns, reader.Record().LSN)
+	}
+	assert.NoError(t, reader.Err())
+	assert.Equal(t, []uint64{start, start + 1, start + 2}, lsns)
+	assert.Equal(t, fi.Size(), reader.Offset())
+}
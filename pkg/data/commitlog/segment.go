@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/crikke/oi/pkg/data"
 	pb "github.com/crikke/oi/proto-gen/data"
 	"github.com/golang/protobuf/proto"
 )
@@ -17,6 +18,9 @@ import (
 const (
 	LogPrefix = "log_"
 	LogSuffix = ".log"
+	// segments are numbered from 1, so LSN 0 is never assigned to a record
+	// and can be used to denote that no record has been applied.
+	firstSegment = 1
 )
 
 // TODO: Ensure that each record is pure
@@ -24,51 +28,93 @@ const (
 // This must be enforced in order to guarantee that the records will be replayed correctly and not
 // corrupt state.
 
+// ErrChecksumMismatch is returned when the checksum of a record does not match its contents
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// CorruptionError reports a record which could not be read from a segment.
+type CorruptionError struct {
+	Segment string
+	// Offset of the corrupt record within the segment
+	Offset int64
+	// Tail is true if no intact record follows the corrupt record. In the newest segment this happens when the server
+	// crashes while the record is written, the records before it are intact. A corrupt record in an older segment is never a torn tail.
+	Tail bool
+	Err  error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupt record in segment %s at offset %d: %v", e.Segment, e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// ReadLogSegment reads all records of the segment and verifies their checksums.
+//
+// If a record is corrupt the records before it are returned together with a *CorruptionError.
+// Prefer SegmentReader for large segments, since all records are held in memory.
 func ReadLogSegment(ctx context.Context, r io.Reader) ([]*pb.Record, error) {
+
 	records := make([]*pb.Record, 0)
-	loop := true
-	for loop {
+	reader := NewSegmentReader(r, 0)
+	for reader.Next() {
 		select {
 		case <-ctx.Done():
-			break
+			return records, nil
 		default:
+		}
+		records = append(records, reader.Record())
+	}
 
-			pe := &data.ProtoEntry{}
-			if _, err := pe.ReadFrom(r); err != nil {
+	return records, reader.Err()
+}
 
-				if errors.Is(err, io.EOF) {
-					loop = false
-					break
-				}
-				return nil, fmt.Errorf("[ReadLogSegment] fatal: %w", err)
-			}
-			record := &pb.Record{}
+// decodeRecord unmarshals the record and verifies its checksum
+func decodeRecord(data []byte) (*pb.Record, error) {
 
-			if err := proto.Unmarshal(pe.Data, record); err != nil {
-				return nil, err
-			}
+	record := &pb.Record{}
+	if err := proto.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
 
-			records = append(records, record)
+	// zeroed data decodes to an empty record
+	if len(Mutations(record)) == 0 {
+		return nil, errors.New("record has no mutations")
+	}
 
-		}
+	if record.ChecksumVersion > ChecksumVersion {
+		return nil, fmt.Errorf("unknown checksum version %d", record.ChecksumVersion)
+	}
 
+	checksum, err := Checksum(record)
+	if err != nil {
+		return nil, err
 	}
 
-	return records, nil
+	if checksum != record.Checksum {
+		return nil, ErrChecksumMismatch
+	}
+	return record, nil
 }
 
-func parseSegmentName(str string) (uint64, error) {
+// ParseSegmentName returns the segment number of the segment file
+func ParseSegmentName(str string) (uint64, error) {
 
-	name := strings.TrimPrefix(strings.TrimSuffix(str, LogSuffix), LogPrefix)
+	name := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(str), LogSuffix), LogPrefix)
 	n, err := strconv.ParseUint(name, 10, 64)
 	if err != nil {
 		return 0, err
 	}
 
-	return n >> 32, nil
+	return n, nil
 
 }
 
+func segmentName(segmentNumber uint32) string {
+	return fmt.Sprintf("%s%d%s", LogPrefix, segmentNumber, LogSuffix)
+}
+
 // Returns the segmentnumber for the LSN which are the 32 first bits
 func SegmentNumber(lsn uint64) uint32 {
 
@@ -98,7 +144,7 @@ func GetTrailingSegments(dir string, lsn uint64) ([]os.DirEntry, error) {
 			continue
 		}
 
-		segmentLsn, err := parseSegmentName(entry.Name())
+		segmentLsn, err := ParseSegmentName(entry.Name())
 
 		if err != nil {
 			return nil, fmt.Errorf("[GetTrailingSegments] error parsing segment name: %w", err)
@@ -108,9 +154,17 @@ func GetTrailingSegments(dir string, lsn uint64) ([]os.DirEntry, error) {
 		}
 	}
 
+	// the directory is sorted by name, which does not match the segment order once the segment number has more digits
+	sort.Slice(res, func(i, j int) bool {
+		a, _ := ParseSegmentName(res[i].Name())
+		b, _ := ParseSegmentName(res[j].Name())
+		return a < b
+	})
+
 	return res, nil
 }
 
+// GetLatestSegment opens the most recent segment for writing. If there are no segments the first segment is created.
 func GetLatestSegment(logDir string, maxSegmentSize int) (*os.File, error) {
 
 	segments, err := GetTrailingSegments(logDir, uint64(0))
@@ -119,7 +173,81 @@ func GetLatestSegment(logDir string, maxSegmentSize int) (*os.File, error) {
 		return nil, err
 	}
 
-	segment := segments[len(segments)-1]
+	name := segmentName(firstSegment)
+	if len(segments) > 0 {
+		name = segments[len(segments)-1].Name()
+	}
 
-	return os.Open(segment.Name())
+	return os.OpenFile(filepath.Join(logDir, name), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0660)
+}
+
+// CreateSegmentAfter creates the segment following the segment of lsn if the log directory has no segment with a number
+// greater than or equal to it, so the records written to the log directory get a LSN greater than lsn.
+// This is the case for a restored database whose records are in the snapshot and not in the log directory.
+func CreateSegmentAfter(logDir string, lsn uint64) error {
+
+	segments, err := GetTrailingSegments(logDir, lsn)
+	if err != nil {
+		return fmt.Errorf("[CreateSegmentAfter] fatal: %w", err)
+	}
+
+	if len(segments) > 0 || lsn == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(logDir, segmentName(SegmentNumber(lsn)+1)), os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		return fmt.Errorf("[CreateSegmentAfter] fatal: %w", err)
+	}
+	return f.Close()
+}
+
+// RemoveAppliedSegments deletes the segments where every record has a LSN below or equal to lsn.
+// The segment containing the LSN is kept, since it may contain later records.
+//
+// If archiver is not nil the segments which are not yet archived are archived before they are removed. The writer archives
+// the segments once they are sealed, a segment is only missing if the server crashed before it was archived.
+func RemoveAppliedSegments(logDir string, lsn uint64, archiver Archiver) error {
+
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return fmt.Errorf("[RemoveAppliedSegments] fatal: %w", err)
+	}
+
+	archived := make(map[string]bool)
+	if archiver != nil {
+		names, err := archiver.Segments()
+		if err != nil {
+			return fmt.Errorf("[RemoveAppliedSegments] fatal: %w", err)
+		}
+		for _, name := range names {
+			archived[name] = true
+		}
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), LogPrefix) || !strings.HasSuffix(entry.Name(), LogSuffix) {
+			continue
+		}
+
+		n, err := ParseSegmentName(entry.Name())
+		if err != nil {
+			return fmt.Errorf("[RemoveAppliedSegments] error parsing segment name: %w", err)
+		}
+
+		if n >= uint64(SegmentNumber(lsn)) {
+			continue
+		}
+
+		if archiver != nil && !archived[entry.Name()] {
+			if err := archiver.Archive(filepath.Join(logDir, entry.Name())); err != nil {
+				return fmt.Errorf("[RemoveAppliedSegments] fatal: %w", err)
+			}
+		}
+
+		if err := os.Remove(filepath.Join(logDir, entry.Name())); err != nil {
+			return fmt.Errorf("[RemoveAppliedSegments] fatal: %w", err)
+		}
+	}
+	return nil
 }
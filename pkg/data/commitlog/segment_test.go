@@ -1,9 +1,16 @@
 package commitlog
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func Test_get_last_applied_segment(t *testing.T) {
@@ -23,3 +30,66 @@ func Test_get_last_applied_record(t *testing.T) {
 
 	assert.Equal(t, 123, RecordNumber(segment))
 }
+
+func TestRemoveAppliedSegments(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	for i := uint32(1); i <= 3; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, segmentName(i)), nil, 0660))
+	}
+
+	// record 5 of segment 2
+	assert.NoError(t, RemoveAppliedSegments(dir, uint64(2)<<32|5, nil))
+
+	segments, err := GetTrailingSegments(dir, 0)
+	assert.NoError(t, err)
+	assert.Len(t, segments, 2)
+	assert.Equal(t, segmentName(2), segments[0].Name())
+}
+
+func TestDecodeRecordChecksum(t *testing.T) {
+
+	record := &pb.Record{
+		LSN:             uint64(2)<<32 | 5,
+		Data:            &pb.Mutation{Key: []byte("a"), Value: []byte("1")},
+		Timestamp:       timestamppb.Now(),
+		ChecksumVersion: ChecksumVersion,
+	}
+	checksum, err := Checksum(record)
+	assert.NoError(t, err)
+	record.Checksum = checksum
+
+	data, err := proto.Marshal(record)
+	assert.NoError(t, err)
+	_, err = decodeRecord(data)
+	assert.NoError(t, err)
+
+	// the checksum covers the LSN and the timestamp
+	lsn := proto.Clone(record).(*pb.Record)
+	lsn.LSN++
+	data, err = proto.Marshal(lsn)
+	assert.NoError(t, err)
+	_, err = decodeRecord(data)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	timestamp := proto.Clone(record).(*pb.Record)
+	timestamp.Timestamp.Seconds++
+	data, err = proto.Marshal(timestamp)
+	assert.NoError(t, err)
+	_, err = decodeRecord(data)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// records written before version 1 have a checksum of the mutations only
+	legacy := proto.Clone(record).(*pb.Record)
+	legacy.ChecksumVersion = 0
+	legacy.Checksum, err = Checksum(legacy)
+	assert.NoError(t, err)
+	legacy.LSN++
+	data, err = proto.Marshal(legacy)
+	assert.NoError(t, err)
+	_, err = decodeRecord(data)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,302 @@
+package commitlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// number of live records buffered for a subscriber before it falls back to reading the segments
+const subscriptionBufferSize = 1024
+
+// ErrLSNUnavailable is returned when subscribing from a LSN whose segment has already been removed and is not archived
+var ErrLSNUnavailable = errors.New("lsn is no longer available in the commitlog")
+
+// Subscription delivers the records of the commitlog in LSN order, starting from a given LSN.
+//
+// Records already written are read from the segments, after which the subscription follows the records as they are written.
+// A subscriber which can not keep up with the writer goes back to reading the segments, so no records are skipped.
+// In archive mode the segments which have been removed from the log directory are read from the archive.
+type Subscription struct {
+	w        *Writer
+	archiver Archiver
+	// LSN of the next record to deliver
+	next uint64
+
+	// records received from the writer
+	live chan *pb.Record
+	// true if the subscriber could not keep up and missed live records, guarded by w.subscribersMu
+	lagging bool
+
+	// segments left to read before following the live records
+	segments []subscriptionSegment
+	file     io.ReadCloser
+	reader   *SegmentReader
+}
+
+type subscriptionSegment struct {
+	name     string
+	archived bool
+}
+
+// Subscribe returns a subscription to the records with a LSN greater than or equal to from.
+// If from is 0 the subscription starts at the oldest record in the commitlog. The subscription must be closed.
+//
+// If archiver is not nil the records of removed segments are read from the archive.
+func (w *Writer) Subscribe(from uint64, archiver Archiver) (*Subscription, error) {
+
+	s := &Subscription{
+		w:        w,
+		archiver: archiver,
+		next:     from,
+	}
+
+	if err := s.subscribe(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// subscribe registers the subscription with the writer and lists the segments containing records from s.next.
+// The subscription is registered before the segments are listed, so every record is either in the segments or received live.
+// The archive is listed after the log directory, since segments are archived before they are removed.
+func (s *Subscription) subscribe() error {
+
+	s.w.subscribersMu.Lock()
+	select {
+	case <-s.w.closed:
+		s.w.subscribersMu.Unlock()
+		return s.w.closeErr()
+	default:
+	}
+	s.live = make(chan *pb.Record, subscriptionBufferSize)
+	s.lagging = false
+	s.w.subscribers[s] = struct{}{}
+	s.w.subscribersMu.Unlock()
+
+	segments, err := GetTrailingSegments(s.w.logDir, s.next)
+	if err != nil {
+		return fmt.Errorf("[Subscribe] fatal: %w", err)
+	}
+
+	s.segments = make([]subscriptionSegment, 0, len(segments))
+	for _, segment := range segments {
+		s.segments = append(s.segments, subscriptionSegment{name: segment.Name()})
+	}
+
+	if s.next == 0 || (len(segments) > 0 && firstSegmentNumber(segments) <= SegmentNumber(s.next)) {
+		return nil
+	}
+
+	if s.archiver == nil {
+		return ErrLSNUnavailable
+	}
+
+	archived, err := s.archivedSegments(segments)
+	if err != nil {
+		return err
+	}
+	s.segments = append(archived, s.segments...)
+	return nil
+}
+
+// archivedSegments returns the archived segments containing records from s.next which precede the segments in the log directory
+func (s *Subscription) archivedSegments(segments []os.DirEntry) ([]subscriptionSegment, error) {
+
+	names, err := s.archiver.Segments()
+	if err != nil {
+		return nil, fmt.Errorf("[Subscribe] fatal: %w", err)
+	}
+
+	res := make([]subscriptionSegment, 0)
+	for _, name := range names {
+		n, err := ParseSegmentName(name)
+		if err != nil {
+			return nil, fmt.Errorf("[Subscribe] error parsing segment name: %w", err)
+		}
+
+		if n < uint64(SegmentNumber(s.next)) || (len(segments) > 0 && uint32(n) >= firstSegmentNumber(segments)) {
+			continue
+		}
+
+		// the segment of the LSN has been removed without being archived
+		if len(res) == 0 && uint32(n) > SegmentNumber(s.next) {
+			return nil, ErrLSNUnavailable
+		}
+		res = append(res, subscriptionSegment{name: name, archived: true})
+	}
+
+	if len(res) == 0 {
+		return nil, ErrLSNUnavailable
+	}
+	return res, nil
+}
+
+// Next blocks until the next record is available
+func (s *Subscription) Next(ctx context.Context) (*pb.Record, error) {
+
+	for {
+		r, err := s.nextFromSegments()
+		if err != nil {
+			return nil, err
+		}
+
+		if r != nil {
+			s.next = r.LSN + 1
+			return r, nil
+		}
+
+		select {
+		case r, ok := <-s.live:
+			if !ok {
+				s.w.subscribersMu.Lock()
+				lagging := s.lagging
+				s.w.subscribersMu.Unlock()
+
+				if !lagging {
+					return nil, s.w.closeErr()
+				}
+
+				// the missed records are read from the segments
+				if err := s.subscribe(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// already read from the segments
+			if r.LSN < s.next {
+				continue
+			}
+
+			s.next = r.LSN + 1
+			return r, nil
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// nextFromSegments returns the next record from the segments, or nil once all segments are read
+func (s *Subscription) nextFromSegments() (*pb.Record, error) {
+
+	for {
+		if s.reader == nil {
+			if len(s.segments) == 0 {
+				return nil, nil
+			}
+
+			f, err := s.openSegment(s.segments[0])
+			if err != nil {
+				return nil, err
+			}
+
+			s.file = f
+			s.reader = NewSegmentReader(f, s.next)
+		}
+
+		if s.reader.Next() {
+			return s.reader.Record(), nil
+		}
+
+		err := s.reader.Err()
+		last := len(s.segments) == 1
+		s.closeSegment()
+		s.segments = s.segments[1:]
+
+		if err != nil {
+			// a record which is being written is received live
+			corruption := &CorruptionError{}
+			if !last || !errors.As(err, &corruption) || !corruption.Tail {
+				return nil, fmt.Errorf("[Subscription] fatal: %w", err)
+			}
+		}
+	}
+}
+
+// openSegment opens the segment in the log directory, or in the archive if it is archived
+func (s *Subscription) openSegment(segment subscriptionSegment) (io.ReadCloser, error) {
+
+	if !segment.archived {
+		f, err := os.Open(filepath.Join(s.w.logDir, segment.name))
+		if err == nil {
+			return f, nil
+		}
+
+		// the segment was removed after the segments were listed
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("[Subscription] fatal: %w", err)
+		}
+		if s.archiver == nil {
+			return nil, ErrLSNUnavailable
+		}
+	}
+
+	f, err := s.archiver.Open(segment.name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrLSNUnavailable
+		}
+		return nil, fmt.Errorf("[Subscription] fatal: %w", err)
+	}
+	return f, nil
+}
+
+func (s *Subscription) closeSegment() {
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = nil
+	s.reader = nil
+}
+
+// Close the subscription
+func (s *Subscription) Close() {
+
+	s.w.subscribersMu.Lock()
+	delete(s.w.subscribers, s)
+	s.w.subscribersMu.Unlock()
+
+	s.closeSegment()
+}
+
+// publish sends the record to the subscribers. Subscribers with a full buffer are
+// unregistered and marked as lagging, they read the record from the segments instead.
+func (w *Writer) publish(r *pb.Record) {
+
+	w.subscribersMu.Lock()
+	defer w.subscribersMu.Unlock()
+
+	for s := range w.subscribers {
+		select {
+		case s.live <- r:
+		default:
+			s.lagging = true
+			close(s.live)
+			delete(w.subscribers, s)
+		}
+	}
+}
+
+// closeSubscribers is called once the writer is closed
+func (w *Writer) closeSubscribers() {
+
+	w.subscribersMu.Lock()
+	defer w.subscribersMu.Unlock()
+
+	for s := range w.subscribers {
+		close(s.live)
+		delete(w.subscribers, s)
+	}
+}
+
+func firstSegmentNumber(segments []os.DirEntry) uint32 {
+	n, _ := ParseSegmentName(segments[0].Name())
+	return uint32(n)
+}
@@ -0,0 +1,128 @@
+package commitlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscription(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := NewWriter(ctx, dir, Configuration{SegmentSize: 4096, Sync: SyncNone}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	write := func(i int) {
+		assert.NoError(t, w.Write(&pb.Mutation{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte("value")}))
+	}
+
+	for i := 0; i < 10; i++ {
+		write(i)
+	}
+
+	sub, err := w.Subscribe(0, nil)
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	// more records than the subscriber buffers are written before the subscriber reads them
+	total := 10 + subscriptionBufferSize + 10
+	for i := 10; i < total; i++ {
+		write(i)
+	}
+
+	prev := uint64(0)
+	for i := 0; i < total; i++ {
+		r, err := sub.Next(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("key%d", i), string(r.Data.Key))
+		assert.Greater(t, r.LSN, prev)
+		prev = r.LSN
+	}
+
+	// resume after the last received record
+	resumed, err := w.Subscribe(prev+1, nil)
+	assert.NoError(t, err)
+	defer resumed.Close()
+
+	write(total)
+	r, err := resumed.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("key%d", total), string(r.Data.Key))
+}
+
+func TestSubscriptionFromArchive(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	archiver, err := NewLocalArchiver(filepath.Join(dir, "archive"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := NewWriter(ctx, dir, Configuration{SegmentSize: 256, Sync: SyncNone}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	write := func(i int) {
+		assert.NoError(t, w.Write(&pb.Mutation{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte("value")}))
+	}
+
+	total := 30
+	for i := 0; i < total; i++ {
+		write(i)
+	}
+
+	sub, err := w.Subscribe(0, nil)
+	assert.NoError(t, err)
+	lsns := make([]uint64, 0, total)
+	for i := 0; i < total; i++ {
+		r, err := sub.Next(ctx)
+		assert.NoError(t, err)
+		lsns = append(lsns, r.LSN)
+	}
+	sub.Close()
+
+	// the segments of all but the last record are archived and removed
+	assert.NoError(t, RemoveAppliedSegments(dir, lsns[total-1], archiver))
+	archived, err := archiver.Segments()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, archived)
+
+	_, err = w.Subscribe(lsns[1], nil)
+	assert.ErrorIs(t, err, ErrLSNUnavailable)
+
+	sub, err = w.Subscribe(lsns[1], archiver)
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	for i := 1; i < total; i++ {
+		r, err := sub.Next(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, lsns[i], r.LSN)
+		assert.Equal(t, fmt.Sprintf("key%d", i), string(r.Data.Key))
+	}
+
+	// followed by the live records
+	write(total)
+	r, err := sub.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("key%d", total), string(r.Data.Key))
+}
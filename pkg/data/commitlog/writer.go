@@ -2,16 +2,55 @@ package commitlog
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
+	protoutil "github.com/crikke/oi/pkg/data"
 	pb "github.com/crikke/oi/proto-gen/data"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// SyncMode decides when the commitlog is fsynced
+type SyncMode string
+
+const (
+	// The commitlog is never fsynced, the OS decides when the data reaches the disk.
+	SyncNone SyncMode = "none"
+	// The commitlog is fsynced every SyncInterval. Writes are acknowledged before they are durable.
+	SyncPeriodic SyncMode = "periodic"
+	// Concurrent writes are grouped and fsynced together. Writes are acknowledged once they are durable.
+	SyncGroup SyncMode = "group"
+)
+
+type Configuration struct {
+	// Size in bytes before a new segment is created
+	// defaults to 64MB
+	SegmentSize uint32
+	// defaults to group
+	Sync SyncMode
+	// How often the commitlog is fsynced when using periodic sync.
+	// defaults to 1s
+	SyncInterval time.Duration
+	// ArchiveDir enables archive mode, segments are copied to a directory per database
+	// once they are sealed.
+	ArchiveDir string
+	// Archiver receives the sealed segments and the current segment when the writer is closed. Set by the database in archive mode.
+	Archiver Archiver
+}
+
+const defaultSegmentSize = 64 << 20
+
+// ErrWriterClosed is returned by writes after the writer has shut down or failed.
+var ErrWriterClosed = errors.New("commitlog writer closed")
+
 type Writer struct {
 	mu            sync.Mutex
 	counter       uint32
@@ -20,124 +59,429 @@ type Writer struct {
 
 	// size of current segment
 	size           int32
-	writerChannel  chan *pb.Mutation
+	writerChannel  chan writeRequest
 	logDir         string
 	maxSegmentSize int
+	sync           SyncMode
+	syncInterval   time.Duration
 	// CallbackFn is called after the writeloop has successfully written the record.
-	// This is used to insert the mutation into the memtree
-	callbackFn func(m *pb.Mutation) error
+	// This is used to insert the mutations into the memtree
+	callbackFn func(lsn uint64, ms []*pb.Mutation) error
+	// nil unless archive mode is enabled
+	archiver Archiver
+
+	// closed once the writeloop has exited, err holds the reason.
+	closed chan struct{}
+	err    error
+
+	// subscribers receive the records once they are applied
+	subscribersMu sync.Mutex
+	subscribers   map[*Subscription]struct{}
 }
 
-func NewWriter(ctx context.Context, logDir string, maxSegmentSize int, callbackFn func(m *pb.Mutation) error) (*Writer, error) {
+type writeRequest struct {
+	mutations []*pb.Mutation
+	// if set, the record is only written if the precondition returns nil
+	precondition func() error
+	// set once the record is written
+	record *pb.Record
+	// receives the result of the write once it is durable and applied
+	done chan error
+}
 
-	f, err := GetLatestSegment(logDir, maxSegmentSize)
+func NewWriter(ctx context.Context, logDir string, cfg Configuration, callbackFn func(lsn uint64, ms []*pb.Mutation) error) (*Writer, error) {
 
-	if err != nil {
-		return nil, fmt.Errorf("[New Writer] fatal: %w", err)
+	if cfg.Sync == "" {
+		cfg.Sync = SyncGroup
 	}
 
-	fi, err := f.Stat()
+	if cfg.SegmentSize == 0 {
+		cfg.SegmentSize = defaultSegmentSize
+	}
+
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = time.Second
+	}
+
+	switch cfg.Sync {
+	case SyncNone, SyncPeriodic, SyncGroup:
+	default:
+		return nil, fmt.Errorf("[New Writer] unknown sync mode %q", cfg.Sync)
+	}
+
+	f, err := GetLatestSegment(logDir, int(cfg.SegmentSize))
 
 	if err != nil {
 		return nil, fmt.Errorf("[New Writer] fatal: %w", err)
 	}
 
-	segmentNumber, err := parseSegmentName(f.Name())
+	segmentNumber, err := ParseSegmentName(f.Name())
 	if err != nil {
 		return nil, fmt.Errorf("[New Writer] fatal: %w", err)
 	}
 
-	records, err := ReadLogSegment(ctx, f)
+	// the records are counted to continue the LSN sequence of the segment
+	records := 0
+	reader := NewSegmentReader(f, 0)
+	for reader.Next() {
+		records++
+	}
+
+	if err := reader.Err(); err != nil {
+		// the record written when the server crashed is removed, otherwise
+		// new records would be appended after it
+		corruption := &CorruptionError{}
+		if !errors.As(err, &corruption) || !corruption.Tail {
+			return nil, fmt.Errorf("[New Writer] fatal: %w", err)
+		}
+
+		if err := truncateSegment(f, corruption.Offset); err != nil {
+			return nil, fmt.Errorf("[New Writer] fatal: %w", err)
+		}
+	}
+
+	fi, err := f.Stat()
+
 	if err != nil {
 		return nil, fmt.Errorf("[New Writer] fatal: %w", err)
 	}
 
 	w := &Writer{
 		mu:             sync.Mutex{},
-		writerChannel:  make(chan *pb.Mutation),
+		writerChannel:  make(chan writeRequest),
 		file:           f,
 		size:           int32(fi.Size()),
 		logDir:         logDir,
-		counter:        uint32(len(records)) - 1,
-		maxSegmentSize: maxSegmentSize,
+		counter:        uint32(records),
+		maxSegmentSize: int(cfg.SegmentSize),
+		sync:           cfg.Sync,
+		syncInterval:   cfg.SyncInterval,
 		segmentNumber:  uint32(segmentNumber),
 		callbackFn:     callbackFn,
+		archiver:       cfg.Archiver,
+		closed:         make(chan struct{}),
+		subscribers:    make(map[*Subscription]struct{}),
 	}
 
 	go w.writeLoop(ctx)
 	return w, nil
 }
 
+// Write the mutation to the commitlog. Returns once the write is acknowledged, see SyncMode.
 func (w *Writer) Write(m *pb.Mutation) error {
 
-	w.writerChannel <- m
-	return nil
+	return w.WriteBatch([]*pb.Mutation{m})
 }
 
-func (w *Writer) writeLoop(ctx context.Context) error {
+// WriteBatch writes the mutations as a single record, so either all or none of the mutations are replayed.
+//
+// Returns once the record is acknowledged according to the SyncMode and the callback has applied the mutations.
+// If the writer has shut down or failed, ErrWriterClosed is returned.
+func (w *Writer) WriteBatch(ms []*pb.Mutation) error {
+	return w.WriteBatchIf(ms, nil)
+}
 
-	for {
-		select {
+// WriteBatchIf writes the mutations as a single record if precondition returns nil, otherwise the error of the precondition is returned.
+//
+// The precondition is evaluated by the write loop once every previously acknowledged record has been applied,
+// and no other record is written until the record of the mutations is applied. So the precondition can read
+// the applied state without it being modified by concurrent writes.
+func (w *Writer) WriteBatchIf(ms []*pb.Mutation, precondition func() error) error {
+
+	req := writeRequest{
+		mutations:    ms,
+		precondition: precondition,
+		done:         make(chan error, 1),
+	}
 
-		case m := <-w.writerChannel:
+	select {
+	case w.writerChannel <- req:
+	case <-w.closed:
+		return w.closeErr()
+	}
 
-			data, err := proto.Marshal(m)
-			if err != nil {
-				return err
-			}
+	return <-req.done
+}
 
-			r := pb.Record{
-				Data:     m,
-				Checksum: crc32.ChecksumIEEE(data),
-			}
+// Wait blocks until the writer has shut down once its context is cancelled. Returns the error which stopped the writer,
+// or nil if it was stopped by the context.
+func (w *Writer) Wait() error {
+	<-w.closed
+	return w.err
+}
 
-			w.mu.Lock()
-			defer w.mu.Unlock()
+func (w *Writer) closeErr() error {
+	if w.err != nil {
+		return fmt.Errorf("%w: %v", ErrWriterClosed, w.err)
+	}
+	return ErrWriterClosed
+}
 
-			// TODO: !! IMPORTANT THIS MUST BE MOVED IF NEW SEGMENT IS CREATED
-			r.LSN = uint64(w.segmentNumber + w.counter)
-			w.counter++
+// writeLoop writes the records of the write requests. If writing or applying a record fails,
+// the loop exits and all following writes fail with ErrWriterClosed since the log can no longer be trusted.
+func (w *Writer) writeLoop(ctx context.Context) (err error) {
+
+	defer func() {
+		w.err = err
+		close(w.closed)
+		w.closeSubscribers()
+	}()
+
+	var tick <-chan time.Time
+	if w.sync == SyncPeriodic {
+		ticker := time.NewTicker(w.syncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 
-			if err != nil {
-				return fmt.Errorf("[writeLoop] error: %w", err)
+	for {
+		select {
+
+		case req := <-w.writerChannel:
+
+			group := []writeRequest{req}
+
+			// writers which are waiting while the previous group was written are
+			// coalesced into one group so they share a single fsync.
+			if w.sync == SyncGroup {
+				group = w.collect(group)
 			}
 
-			if len(data)+int(w.size) > w.maxSegmentSize {
-				if err := w.nextSegment(); err != nil {
-					return fmt.Errorf("[writeLoop] fatal: %w", err)
+			// a precondition must see every previous record applied, so the group is split before each conditional write
+			for len(group) > 0 {
+				n := 1
+				for n < len(group) && group[n].precondition == nil {
+					n++
+				}
+
+				if err := w.commit(group[:n]); err != nil {
+					fail(group[n:], err)
+					return err
 				}
+				group = group[n:]
 			}
 
-			l, err := w.file.Write(data)
+		case <-tick:
+			w.mu.Lock()
+			err := w.file.Sync()
+			w.mu.Unlock()
 
 			if err != nil {
 				return fmt.Errorf("[writeLoop] fatal: %w", err)
 			}
 
-			w.size += int32(l)
+		case <-ctx.Done():
+			w.mu.Lock()
+			defer w.mu.Unlock()
 
-			if err := w.callbackFn(m); err != nil {
-				return err
+			if w.sync != SyncNone {
+				w.file.Sync()
 			}
+			w.file.Close()
 
-		case <-ctx.Done():
-			return nil
+			// the records of the current segment can be restored before the segment is sealed
+			return w.archive()
+
+		}
+	}
+}
+
+// commit writes and applies the records of the group. If the first request has a precondition, it is evaluated before the records are written.
+// If a record fails to be written or applied, the remaining requests of the group are failed and the error is returned.
+func (w *Writer) commit(group []writeRequest) error {
 
+	if group[0].precondition != nil {
+		if err := group[0].precondition(); err != nil {
+			group[0].done <- err
+			group = group[1:]
 		}
 	}
+
+	if len(group) == 0 {
+		return nil
+	}
+
+	if err := w.writeGroup(group); err != nil {
+		fail(group, err)
+		return err
+	}
+
+	for i, req := range group {
+		if err := w.callbackFn(req.record.LSN, req.mutations); err != nil {
+			err = fmt.Errorf("[writeLoop] apply: %w", err)
+			fail(group[i:], err)
+			return err
+		}
+		w.publish(req.record)
+		req.done <- nil
+	}
+	return nil
 }
 
-// closes the current segmentfile and creates the next segment
+// fail the write requests with err
+func fail(group []writeRequest, err error) {
+	for _, req := range group {
+		req.done <- err
+	}
+}
+
+// collect appends the pending write requests to the group without blocking
+func (w *Writer) collect(group []writeRequest) []writeRequest {
+
+	for {
+		select {
+		case req := <-w.writerChannel:
+			group = append(group, req)
+		default:
+			return group
+		}
+	}
+}
+
+// writeGroup writes a record for every request in the group. If group commit is used the segment is fsynced once all records are written
+func (w *Writer) writeGroup(group []writeRequest) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i := range group {
+		r, err := w.writeRecord(group[i].mutations)
+		if err != nil {
+			return err
+		}
+		group[i].record = r
+	}
+
+	if w.sync == SyncGroup {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("[writeGroup] fatal: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeRecord writes the mutations as a record to the current segment and returns the record. w.mu must be held.
+func (w *Writer) writeRecord(ms []*pb.Mutation) (*pb.Record, error) {
+
+	r := &pb.Record{Timestamp: timestamppb.Now()}
+	if len(ms) == 1 {
+		r.Data = ms[0]
+	} else {
+		r.Batch = ms
+	}
+
+	if proto.Size(r)+int(w.size) > w.maxSegmentSize && w.size > 0 {
+		if err := w.nextSegment(); err != nil {
+			return nil, fmt.Errorf("[writeRecord] fatal: %w", err)
+		}
+	}
+
+	r.LSN = uint64(w.segmentNumber)<<32 | uint64(w.counter)
+	w.counter++
+
+	// the checksum covers the LSN, so it is calculated once the LSN is assigned
+	r.ChecksumVersion = ChecksumVersion
+	checksum, err := Checksum(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Checksum = checksum
+
+	data, err := proto.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("[writeRecord] error: %w", err)
+	}
+
+	entry, _ := protoutil.ProtoEntry{Data: data, DataLen: uint32(len(data))}.MarshalBinary()
+	l, err := w.file.Write(entry)
+
+	if err != nil {
+		return nil, fmt.Errorf("[writeRecord] fatal: %w", err)
+	}
+
+	w.size += int32(l)
+	return r, nil
+}
+
+// ChecksumVersion is the version of the checksum of written records
+const ChecksumVersion = 1
+
+// Checksum calculates the checksum of the record. Since version 1 it covers the LSN and timestamp of the record
+// together with its mutations, records of version 0 have a checksum of the mutations only.
+func Checksum(r *pb.Record) (uint32, error) {
+
+	checksum := uint32(0)
+	if r.ChecksumVersion >= 1 {
+		header := binary.LittleEndian.AppendUint64(nil, r.LSN)
+		header = binary.LittleEndian.AppendUint64(header, uint64(r.GetTimestamp().GetSeconds()))
+		header = binary.LittleEndian.AppendUint32(header, uint32(r.GetTimestamp().GetNanos()))
+		checksum = crc32.Update(checksum, crc32.IEEETable, header)
+	}
+
+	for _, m := range Mutations(r) {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			return 0, err
+		}
+		checksum = crc32.Update(checksum, crc32.IEEETable, data)
+	}
+	return checksum, nil
+}
+
+// Mutations returns the mutations of the record
+func Mutations(r *pb.Record) []*pb.Mutation {
+
+	if r.Data != nil {
+		return []*pb.Mutation{r.Data}
+	}
+	return r.Batch
+}
+
+// truncateSegment removes everything after offset from the segment
+func truncateSegment(f *os.File, offset int64) error {
+
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// archive copies the current segment to the archive. w.mu must be held.
+func (w *Writer) archive() error {
+
+	if w.archiver == nil {
+		return nil
+	}
+
+	if err := w.archiver.Archive(filepath.Join(w.logDir, segmentName(w.segmentNumber))); err != nil {
+		return fmt.Errorf("[archive] fatal: %w", err)
+	}
+	return nil
+}
+
+// closes the current segmentfile, archives it and creates the next segment
 func (w *Writer) nextSegment() error {
 
+	// the records of the previous segment must be durable before
+	// records of the next segment are acknowledged
+	if w.sync != SyncNone {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("[nextSegment] fatal: %w", err)
+		}
+	}
+
 	w.file.Close()
+	if err := w.archive(); err != nil {
+		return err
+	}
+
 	w.segmentNumber += 1
-	name := fmt.Sprintf("%s%d%s", LogPrefix, w.segmentNumber, LogSuffix)
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND, 0660)
+	f, err := os.OpenFile(filepath.Join(w.logDir, segmentName(w.segmentNumber)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
 	if err != nil {
 		return fmt.Errorf("[nextSegment] internal error: %w", err)
 	}
 	w.counter = 0
+	w.size = 0
 	w.file = f
 
 	return nil
@@ -0,0 +1,199 @@
+package commitlog
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupCommit(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := NewWriter(ctx, dir, Configuration{SegmentSize: 1024, Sync: SyncGroup}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, w.Write(&pb.Mutation{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte("value")}))
+		}(i)
+	}
+	wg.Wait()
+
+	segments, err := GetTrailingSegments(dir, 0)
+	assert.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+
+	records := 0
+	for _, s := range segments {
+		f, err := os.Open(filepath.Join(dir, s.Name()))
+		assert.NoError(t, err)
+
+		r, err := ReadLogSegment(ctx, f)
+		f.Close()
+		assert.NoError(t, err)
+		records += len(r)
+	}
+	assert.Equal(t, 100, records)
+}
+
+func TestUnknownSyncMode(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	_, err := NewWriter(context.Background(), dir, Configuration{Sync: "always"}, nil)
+	assert.Error(t, err)
+}
+
+func TestDefaultSegmentSize(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := NewWriter(ctx, dir, Configuration{}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, w.Write(&pb.Mutation{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte("value")}))
+	}
+
+	segments, err := GetTrailingSegments(dir, 0)
+	assert.NoError(t, err)
+	assert.Len(t, segments, 1)
+}
+
+func TestWriterClosed(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	applyErr := errors.New("apply failed")
+	w, err := NewWriter(context.Background(), dir, Configuration{SegmentSize: 1024}, func(lsn uint64, ms []*pb.Mutation) error {
+		return applyErr
+	})
+	assert.NoError(t, err)
+
+	err = w.Write(&pb.Mutation{Key: []byte("a"), Value: []byte("1")})
+	assert.ErrorIs(t, err, applyErr)
+
+	err = w.Write(&pb.Mutation{Key: []byte("b"), Value: []byte("1")})
+	assert.ErrorIs(t, err, ErrWriterClosed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err = NewWriter(ctx, dir, Configuration{SegmentSize: 1024}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(&pb.Mutation{Key: []byte("c"), Value: []byte("1")}))
+
+	cancel()
+	<-w.closed
+	assert.ErrorIs(t, w.Write(&pb.Mutation{Key: []byte("d"), Value: []byte("1")}), ErrWriterClosed)
+}
+
+func TestTornWrite(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := NewWriter(ctx, dir, Configuration{SegmentSize: 1024}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(&pb.Mutation{Key: []byte("a"), Value: []byte("1")}))
+	assert.NoError(t, w.Write(&pb.Mutation{Key: []byte("b"), Value: []byte("1")}))
+	cancel()
+	<-w.closed
+
+	path := filepath.Join(dir, segmentName(firstSegment))
+	intact, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// half written record
+	assert.NoError(t, os.WriteFile(path, append(intact, 0x20, 0x00, 0x00, 0x00, 0x0a), 0660))
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	records, err := ReadLogSegment(context.Background(), f)
+	f.Close()
+
+	corruption := &CorruptionError{}
+	assert.ErrorAs(t, err, &corruption)
+	assert.True(t, corruption.Tail)
+	assert.Equal(t, int64(len(intact)), corruption.Offset)
+	assert.Len(t, records, 2)
+
+	// the writer removes the torn record
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	w, err = NewWriter(ctx, dir, Configuration{SegmentSize: 1024}, func(lsn uint64, ms []*pb.Mutation) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(&pb.Mutation{Key: []byte("c"), Value: []byte("1")}))
+
+	f, err = os.Open(path)
+	assert.NoError(t, err)
+	records, err = ReadLogSegment(context.Background(), f)
+	f.Close()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	// corruption of a record which is followed by other records
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[6] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0660))
+
+	f, err = os.Open(path)
+	assert.NoError(t, err)
+	_, err = ReadLogSegment(context.Background(), f)
+	f.Close()
+
+	assert.ErrorAs(t, err, &corruption)
+	assert.False(t, corruption.Tail)
+
+	// a corrupt length of a record which is followed by other records
+	data[6] ^= 0xff
+	binary.LittleEndian.PutUint32(data[0:4], 0xffffffff)
+	assert.NoError(t, os.WriteFile(path, data, 0660))
+
+	f, err = os.Open(path)
+	assert.NoError(t, err)
+	_, err = ReadLogSegment(context.Background(), f)
+	f.Close()
+
+	assert.ErrorAs(t, err, &corruption)
+	assert.False(t, corruption.Tail)
+	assert.Equal(t, int64(0), corruption.Offset)
+}
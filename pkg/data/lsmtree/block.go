@@ -0,0 +1,239 @@
+package lsmtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	protoutil "github.com/crikke/oi/pkg/data"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/proto"
+)
+
+// The data file of a SSTable, data.db, consists of data blocks followed by the range tombstone block, the index block and the footer.
+//
+//	[data block 1] ... [data block n] [range tombstone block] [index block] [footer]
+//
+// A data block contains length prefixed mutations in key order. Blocks are written once they exceed the block size,
+// so a block holds at least one mutation. The index block contains a length prefixed IndexEntry per data block,
+// with the first key of the block and its position and size in the file. The range tombstone block contains the
+// length prefixed range tombstones ordered by their start, it is only written if the SSTable has range tombstones.
+//
+// Every block is stored compressed, followed by a trailer with the compression type and the crc32 checksum of the
+// compressed block and the compression type.
+//
+//	[compressed block] [compression type: 1 byte] [crc32: 4 bytes]
+//
+// The footer has a fixed size and is located at the end of the file
+//
+//	[index position: 8 bytes] [index size: 8 bytes] [range tombstone position: 8 bytes] [range tombstone size: 8 bytes]
+//	[entries: 8 bytes] [version: 4 bytes] [magic: 4 bytes] [crc32: 4 bytes]
+//
+// All integers are little endian. The checksum of the footer covers the preceding fields of the footer. The range
+// tombstone size is 0 if there are no range tombstones.
+//
+// Version 1 footers have no range tombstone position and size, the range tombstones of those SSTables are stored in rangedel.db.
+
+const (
+	// sstableMagic identifies the data file of a SSTable
+	sstableMagic = 0x5453494f // "OIST"
+	// sstableFormatVersion is the version of the format written
+	sstableFormatVersion = 2
+
+	blockTrailerSize = 5
+	footerSize       = 52
+	// size of the footer of version 1
+	legacyFooterSize = 36
+
+	// defaultBlockSize is the size in bytes of the uncompressed data blocks
+	defaultBlockSize = 4096
+)
+
+// ErrCorruptSSTable is returned when a checksum of the SSTable does not match or the SSTable can not be decoded
+var ErrCorruptSSTable = errors.New("corrupt sstable")
+
+type footer struct {
+	index *pb.IndexEntry
+	// nil if there are no range tombstones
+	rangeTombstones *pb.IndexEntry
+	entries         uint64
+	version         uint32
+}
+
+func (f footer) marshal() []byte {
+
+	b := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(b[0:8], f.index.Position)
+	binary.LittleEndian.PutUint64(b[8:16], f.index.Size)
+	if f.rangeTombstones != nil {
+		binary.LittleEndian.PutUint64(b[16:24], f.rangeTombstones.Position)
+		binary.LittleEndian.PutUint64(b[24:32], f.rangeTombstones.Size)
+	}
+	binary.LittleEndian.PutUint64(b[32:40], f.entries)
+	binary.LittleEndian.PutUint32(b[40:44], f.version)
+	binary.LittleEndian.PutUint32(b[44:48], sstableMagic)
+	binary.LittleEndian.PutUint32(b[48:52], crc32.ChecksumIEEE(b[:48]))
+	return b
+}
+
+// unmarshalFooter decodes the footer at the end of b. b holds the last footerSize bytes of the data file,
+// or the whole file if it is shorter.
+func unmarshalFooter(b []byte) (footer, error) {
+
+	n := len(b)
+	if n < legacyFooterSize || binary.LittleEndian.Uint32(b[n-8:n-4]) != sstableMagic {
+		return footer{}, fmt.Errorf("%w: not a sstable data file", ErrCorruptSSTable)
+	}
+
+	version := binary.LittleEndian.Uint32(b[n-12 : n-8])
+	switch {
+	case version == 1:
+		b = b[n-legacyFooterSize:]
+	case version == sstableFormatVersion && n == footerSize:
+	case version == sstableFormatVersion:
+		return footer{}, fmt.Errorf("%w: file too short", ErrCorruptSSTable)
+	default:
+		return footer{}, fmt.Errorf("unsupported sstable format version %d", version)
+	}
+
+	n = len(b)
+	if crc32.ChecksumIEEE(b[:n-4]) != binary.LittleEndian.Uint32(b[n-4:]) {
+		return footer{}, fmt.Errorf("%w: footer checksum mismatch", ErrCorruptSSTable)
+	}
+
+	f := footer{
+		index: &pb.IndexEntry{
+			Position: binary.LittleEndian.Uint64(b[0:8]),
+			Size:     binary.LittleEndian.Uint64(b[8:16]),
+		},
+		entries: binary.LittleEndian.Uint64(b[n-20 : n-12]),
+		version: version,
+	}
+
+	if version == sstableFormatVersion {
+		if size := binary.LittleEndian.Uint64(b[24:32]); size > 0 {
+			f.rangeTombstones = &pb.IndexEntry{Position: binary.LittleEndian.Uint64(b[16:24]), Size: size}
+		}
+	}
+	return f, nil
+}
+
+// encodeBlock compresses the block and appends the trailer
+func encodeBlock(block []byte, t CompressionType) ([]byte, error) {
+
+	codec, err := getCodec(t)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := codec.Encode(nil, block)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, byte(t))
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b)), nil
+}
+
+// decodeBlock verifies the checksum of the block and returns it decompressed
+func decodeBlock(b []byte) ([]byte, error) {
+
+	if len(b) < blockTrailerSize {
+		return nil, fmt.Errorf("%w: block too short", ErrCorruptSSTable)
+	}
+
+	n := len(b) - 4
+	if crc32.ChecksumIEEE(b[:n]) != binary.LittleEndian.Uint32(b[n:]) {
+		return nil, fmt.Errorf("%w: block checksum mismatch", ErrCorruptSSTable)
+	}
+
+	codec, err := getCodec(CompressionType(b[n-1]))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := codec.Decode(nil, b[:n-1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptSSTable, err)
+	}
+	return block, nil
+}
+
+// readBlock reads the block referenced by the index entry
+func readBlock(r io.ReaderAt, h *pb.IndexEntry) ([]byte, error) {
+
+	b := make([]byte, h.Size)
+	if _, err := r.ReadAt(b, int64(h.Position)); err != nil {
+		return nil, err
+	}
+	return decodeBlock(b)
+}
+
+// appendEntry appends the length prefixed message to the block
+func appendEntry(block []byte, m proto.Message) ([]byte, error) {
+
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, _ := protoutil.ProtoEntry{Data: data, DataLen: uint32(len(data))}.MarshalBinary()
+	return append(block, entry...), nil
+}
+
+// decodeMutations decodes the mutations of a data block
+func decodeMutations(block []byte) ([]*pb.Mutation, error) {
+
+	ms := make([]*pb.Mutation, 0)
+	err := readEntries(block, func(data []byte) error {
+		m := &pb.Mutation{}
+		ms = append(ms, m)
+		return proto.Unmarshal(data, m)
+	})
+	return ms, err
+}
+
+// decodeIndex decodes the entries of the index block
+func decodeIndex(block []byte) ([]*pb.IndexEntry, error) {
+
+	index := make([]*pb.IndexEntry, 0)
+	err := readEntries(block, func(data []byte) error {
+		e := &pb.IndexEntry{}
+		index = append(index, e)
+		return proto.Unmarshal(data, e)
+	})
+	return index, err
+}
+
+// decodeRangeTombstones decodes the range tombstones of the range tombstone block
+func decodeRangeTombstones(block []byte) ([]*pb.RangeTombstone, error) {
+
+	rts := make([]*pb.RangeTombstone, 0)
+	err := readEntries(block, func(data []byte) error {
+		rt := &pb.RangeTombstone{}
+		rts = append(rts, rt)
+		return proto.Unmarshal(data, rt)
+	})
+	return rts, err
+}
+
+// readEntries calls fn with every length prefixed entry of the block
+func readEntries(block []byte, fn func(data []byte) error) error {
+
+	r := bytes.NewReader(block)
+	for r.Len() > 0 {
+
+		pe := &protoutil.ProtoEntry{}
+		if _, err := pe.ReadFrom(r); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptSSTable, err)
+		}
+
+		if err := fn(pe.Data); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptSSTable, err)
+		}
+	}
+	return nil
+}
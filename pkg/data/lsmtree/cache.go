@@ -0,0 +1,283 @@
+package lsmtree
+
+import (
+	"container/list"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/crikke/oi/pkg/bloom"
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// Reads of SSTables go through two caches.
+//
+// The table cache keeps the data files of recently read SSTables open, together with their index, bloom filter and
+// range tombstones, so a read does not have to open and parse the files of every SSTable it searches. The number of
+// open SSTables is bounded, the least recently used SSTable is closed once the limit is exceeded.
+//
+// The block cache holds the decoded data blocks of the open SSTables, bounded by the size of the uncompressed blocks.
+// It is shared by all SSTables of the LSMTree. Compactions read their inputs without the caches.
+
+type CacheConfiguration struct {
+	// Maximum number of SSTables kept open by the table cache.
+	// defaults to 500
+	MaxOpenTables int
+	// Size in bytes of the block cache.
+	// defaults to 8mb
+	BlockCacheSize int64
+}
+
+func (c CacheConfiguration) withDefaults() CacheConfiguration {
+
+	if c.MaxOpenTables <= 0 {
+		c.MaxOpenTables = 500
+	}
+
+	if c.BlockCacheSize <= 0 {
+		c.BlockCacheSize = 8 << 20
+	}
+	return c
+}
+
+// CacheStats counts the hits and misses of the table and block cache
+type CacheStats struct {
+	TableHits   uint64
+	TableMisses uint64
+	BlockHits   uint64
+	BlockMisses uint64
+}
+
+// table is an open SSTable of the table cache
+type table struct {
+	path            string
+	reader          *tableReader
+	filter          bloom.Filter
+	rangeTombstones []*pb.RangeTombstone
+	properties      *pb.TableProperties
+	// nil if the SSTable has no prefix filter
+	prefixFilter bloom.Filter
+
+	// guarded by the mutex of the table cache. The table is closed once it is evicted and no longer referenced.
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+type tableCache struct {
+	mu       sync.Mutex
+	capacity int
+	tables   map[string]*table
+	// least recently used at the back
+	lru    *list.List
+	blocks *blockCache
+	// identifies the blocks of the tables in the block cache, a table gets a new id every time it is opened
+	nextID uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newTableCache(cfg CacheConfiguration) *tableCache {
+
+	cfg = cfg.withDefaults()
+	return &tableCache{
+		capacity: cfg.MaxOpenTables,
+		tables:   make(map[string]*table),
+		lru:      list.New(),
+		blocks:   newBlockCache(cfg.BlockCacheSize),
+	}
+}
+
+// acquire returns the open SSTable in path, the table must be released once it is no longer used
+func (c *tableCache) acquire(path string) (*table, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.tables[path]; ok {
+		c.hits.Add(1)
+		c.lru.MoveToFront(t.elem)
+		t.refs++
+		return t, nil
+	}
+	c.misses.Add(1)
+
+	t, err := c.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t.refs++
+	t.elem = c.lru.PushFront(t)
+	c.tables[path] = t
+
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back().Value.(*table))
+	}
+	return t, nil
+}
+
+func (c *tableCache) open(path string) (*table, error) {
+
+	reader, err := openTable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := bloom.Open(filepath.Join(path, "bloom.db"))
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	properties, err := readTableProperties(path)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	prefixFilter, err := openPrefixFilter(path)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	c.nextID++
+	reader.id = c.nextID
+	reader.blocks = c.blocks
+
+	return &table{path: path, reader: reader, filter: filter, rangeTombstones: reader.rangeTombstones, properties: properties, prefixFilter: prefixFilter}, nil
+}
+
+func (c *tableCache) release(t *table) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t.refs--
+	if t.refs == 0 && t.evicted {
+		return t.reader.Close()
+	}
+	return nil
+}
+
+// evict removes the SSTable in path from the cache. It must be called before a SSTable is removed or replaced.
+func (c *tableCache) evict(path string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.tables[path]; ok {
+		c.remove(t)
+	}
+}
+
+// remove the table from the cache, it is closed once it is no longer referenced. c.mu must be held.
+func (c *tableCache) remove(t *table) {
+
+	delete(c.tables, t.path)
+	c.lru.Remove(t.elem)
+	t.evicted = true
+
+	if t.refs == 0 {
+		t.reader.Close()
+	}
+}
+
+// close evicts every SSTable
+func (c *tableCache) close() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.tables {
+		c.remove(t)
+	}
+}
+
+// tableIterator returns an iterator over the acquired table which releases the table once closed
+func (c *tableCache) tableIterator(t *table) *sstableIterator {
+
+	return &sstableIterator{
+		t:               t.reader,
+		rangeTombstones: t.rangeTombstones,
+		close:           func() error { return c.release(t) },
+	}
+}
+
+func (c *tableCache) stats() CacheStats {
+	return CacheStats{
+		TableHits:   c.hits.Load(),
+		TableMisses: c.misses.Load(),
+		BlockHits:   c.blocks.hits.Load(),
+		BlockMisses: c.blocks.misses.Load(),
+	}
+}
+
+type blockKey struct {
+	table uint64
+	block int
+}
+
+type cachedBlock struct {
+	key       blockKey
+	mutations []*pb.Mutation
+	size      int64
+}
+
+// blockCache is a LRU cache of decoded data blocks, bounded by the uncompressed size of the blocks
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	blocks   map[blockKey]*list.Element
+	lru      *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newBlockCache(capacity int64) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		blocks:   make(map[blockKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *blockCache) get(key blockKey) ([]*pb.Mutation, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.blocks[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cachedBlock).mutations, true
+}
+
+// add the block, size is the size of the uncompressed block. Blocks larger than the cache are not added.
+func (c *blockCache) add(key blockKey, mutations []*pb.Mutation, size int64) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.blocks[key]; ok || size > c.capacity {
+		return
+	}
+
+	c.blocks[key] = c.lru.PushFront(&cachedBlock{key: key, mutations: mutations, size: size})
+	c.size += size
+
+	for c.size > c.capacity {
+		b := c.lru.Remove(c.lru.Back()).(*cachedBlock)
+		delete(c.blocks, b.key)
+		c.size -= b.size
+	}
+}
@@ -0,0 +1,59 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableCache(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	for i, key := range []string{"a", "b"} {
+		rbt := &memtree.RBTree{}
+		rbt.Insert(&pb.Mutation{Key: []byte(key), Value: []byte(key)})
+		writeSSTable(t, filepath.Join(dir, sstableName(0, uint64(i+1))), rbt)
+	}
+
+	// newest first
+	paths := []string{filepath.Join(dir, sstableName(0, 2)), filepath.Join(dir, sstableName(0, 1))}
+
+	c := newTableCache(CacheConfiguration{MaxOpenTables: 1})
+	defer c.close()
+
+	// a is found in the oldest SSTable, so both are searched
+	val, err := c.getAt(paths, []byte("a"), 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), val)
+	assert.Equal(t, CacheStats{TableMisses: 2, BlockMisses: 1}, c.stats())
+
+	// the newest SSTable was evicted when the oldest was opened
+	val, err = c.getAt(paths, []byte("b"), 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), val)
+	assert.Equal(t, CacheStats{TableMisses: 3, BlockMisses: 2}, c.stats())
+
+	val, err = c.getAt(paths, []byte("b"), 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), val)
+	assert.Equal(t, CacheStats{TableHits: 1, TableMisses: 3, BlockHits: 1, BlockMisses: 2}, c.stats())
+
+	// an iterator keeps an evicted SSTable open
+	table, err := c.acquire(filepath.Join(dir, sstableName(0, 2)))
+	assert.NoError(t, err)
+	it := c.tableIterator(table)
+	c.evict(filepath.Join(dir, sstableName(0, 2)))
+
+	it.Seek(nil)
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("b"), it.Mutation().Key)
+	assert.NoError(t, it.Close())
+}
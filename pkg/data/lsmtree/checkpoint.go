@@ -0,0 +1,79 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Flush writes the memtree to a SSTable and returns once every memtree written before the call is flushed.
+//
+// If a flush fails the error is returned, and the memtree is retried in the background. Memtrees are flushed in order,
+// so a later Flush returns once the failed memtree has been persisted.
+func (l *LSMTree) Flush() error {
+
+	done := make(chan error, 1)
+
+	select {
+	case l.forceFlushCh <- done:
+	case <-l.done:
+		return ErrClosed
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("[Flush] fatal: %w", err)
+		}
+	case <-l.done:
+		return ErrClosed
+	}
+	return nil
+}
+
+// Checkpoint flushes the memtree, hard links the files of every SSTable into dir and writes a manifest of the SSTables to dir.
+// SSTables are immutable, so the links remain valid after the SSTables are compacted.
+//
+// Returns the LSN of the most recent record flushed by this process, every record up to the LSN
+// is included in the checkpoint. If nothing has been flushed 0 is returned.
+func (l *LSMTree) Checkpoint(dir string) (uint64, error) {
+
+	if err := l.Flush(); err != nil {
+		return 0, err
+	}
+
+	// prevents flushes and compactions from changing the SSTables while they are linked
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, table := range l.version {
+		if err := linkDir(filepath.Join(l.Configuration.DataDir, table.name), filepath.Join(dir, table.name)); err != nil {
+			return 0, fmt.Errorf("[Checkpoint] fatal: %w", err)
+		}
+	}
+
+	if err := writeManifest(dir, l.version); err != nil {
+		return 0, fmt.Errorf("[Checkpoint] fatal: %w", err)
+	}
+	return l.flushedLSN, nil
+}
+
+// linkDir creates dst and hard links every file of src into it
+func linkDir(src, dst string) error {
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := os.Link(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return syncDir(dst)
+}
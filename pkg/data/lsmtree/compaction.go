@@ -0,0 +1,587 @@
+package lsmtree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// CompactionStrategy decides which SSTables are merged together
+type CompactionStrategy interface {
+	// pick returns the next compaction or nil if no compaction is needed.
+	pick(levels [][]*tableInfo) *compactionTask
+}
+
+const (
+	LeveledCompaction    = "leveled"
+	SizeTieredCompaction = "size-tiered"
+)
+
+// NewCompactionStrategy returns the strategy selected by the configuration
+func NewCompactionStrategy(cfg CompactionConfiguration) (CompactionStrategy, error) {
+
+	cfg = cfg.withDefaults()
+	switch cfg.Strategy {
+	case LeveledCompaction:
+		return &leveledCompaction{
+			cfg:            cfg,
+			compactPointer: make(map[int][]byte),
+		}, nil
+	case SizeTieredCompaction:
+		return &sizeTieredCompaction{cfg: cfg.SizeTiered}, nil
+	}
+	return nil, fmt.Errorf("unknown compaction strategy '%s'", cfg.Strategy)
+}
+
+// Leveled compaction
+//
+// Memtrees are flushed into level 0. The SSTables in level 0 may overlap each other, so every one of them
+// has to be searched on a read. Once level 0 contains Level0Trigger SSTables they are merged together with the
+// overlapping SSTables of level 1.
+//
+// The SSTables of level 1 and above do not overlap, so at most one SSTable per level is searched on a read.
+// Each level has a maximum size which is LevelSizeRatio times larger than the previous level.
+// When a level exceeds its size, one of its SSTables is merged into the overlapping SSTables of the next level.
+//
+// When merging, only the most recent version of each key is kept. Tombstones are dropped when there is no older data
+// that they could shadow, i.e no SSTable in a deeper level overlaps the compaction, and the grace period has passed.
+
+type CompactionConfiguration struct {
+	// Either leveled or size-tiered.
+	// defaults to leveled
+	Strategy string
+
+	// Number of SSTables in level 0 which triggers a compaction into level 1.
+	// defaults to 4
+	Level0Trigger int
+	// Maximum size in bytes of level 1.
+	// defaults to 10mb
+	BaseLevelSize int64
+	// The size ratio between two levels.
+	// defaults to 10
+	LevelSizeRatio int
+	// Number of levels.
+	// defaults to 7
+	MaxLevels int
+	// Size in bytes when the output of a compaction is split into a new SSTable.
+	// defaults to 2mb
+	TargetFileSize int64
+
+	// Tombstones are kept at least this long after the deletion before they are purged.
+	// defaults to 0, purging tombstones as soon as there is no older data left to shadow.
+	TombstoneGracePeriod time.Duration
+
+	SizeTiered SizeTieredConfiguration
+}
+
+func (c CompactionConfiguration) withDefaults() CompactionConfiguration {
+
+	if c.Strategy == "" {
+		c.Strategy = LeveledCompaction
+	}
+	if c.Level0Trigger <= 0 {
+		c.Level0Trigger = 4
+	}
+	if c.BaseLevelSize <= 0 {
+		c.BaseLevelSize = 10 << 20
+	}
+	if c.LevelSizeRatio <= 1 {
+		c.LevelSizeRatio = 10
+	}
+	if c.MaxLevels < 2 {
+		c.MaxLevels = 7
+	}
+	if c.TargetFileSize <= 0 {
+		c.TargetFileSize = 2 << 20
+	}
+	c.SizeTiered = c.SizeTiered.withDefaults()
+	return c
+}
+
+// maxLevelSize returns the maximum size in bytes of level
+func (c CompactionConfiguration) maxLevelSize(level int) float64 {
+	return float64(c.BaseLevelSize) * math.Pow(float64(c.LevelSizeRatio), float64(level-1))
+}
+
+// tableInfo contains the metadata of a SSTable recorded in the manifest.
+// The generation orders the SSTables of level 0, it differs from the generation in the name when a compaction keeps the generation of its input.
+type tableInfo struct {
+	sstableRef
+	size     int64
+	entries  int
+	smallest []byte
+	largest  []byte
+	// sequence range of the mutations and range tombstones
+	minSequence uint64
+	maxSequence uint64
+}
+
+func (t *tableInfo) overlaps(smallest, largest []byte) bool {
+	return bytes.Compare(t.largest, smallest) >= 0 && bytes.Compare(t.smallest, largest) <= 0
+}
+
+type compactionTask struct {
+	level       int
+	outputLevel int
+	// inputs ordered from the most recent to the oldest
+	inputs []*tableInfo
+	// true if no SSTable older than the inputs overlaps the compaction
+	bottommost bool
+	// the output is split into a new SSTable when it reaches the size. If 0 the output is never split.
+	maxOutputSize int64
+	// the output takes the ordering generation of the most recent input, this keeps the output at the same position
+	// as its inputs when the SSTables of level 0 are ordered by generation.
+	keepGeneration bool
+}
+
+// scheduleCompaction notifies the compaction loop that the SSTables have changed
+func (l *LSMTree) scheduleCompaction() {
+	select {
+	case l.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+func (l *LSMTree) compactionLoop() {
+
+	for {
+		select {
+		case <-l.compactCh:
+			for {
+				compacted, err := l.compactOnce()
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				if err != nil {
+					log.Printf("[compaction] error: %v", err)
+					break
+				}
+				if !compacted {
+					break
+				}
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// closed reports if Close has been called
+func (l *LSMTree) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// compactOnce picks and runs a single compaction. Returns false if no compaction was needed.
+func (l *LSMTree) compactOnce() (bool, error) {
+
+	levels, err := l.levels()
+	if err != nil {
+		return false, err
+	}
+
+	task := l.strategy.pick(levels)
+	if task == nil {
+		return false, nil
+	}
+
+	if err := l.compact(task); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// levels returns the SSTables of the version grouped by level.
+// Level 0 is ordered from the most recent to the oldest, the other levels are ordered by key.
+func (l *LSMTree) levels() ([][]*tableInfo, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	maxLevels := l.Configuration.Compaction.withDefaults().MaxLevels
+	levels := make([][]*tableInfo, maxLevels)
+	for _, t := range l.version {
+
+		level := t.level
+		if level >= maxLevels {
+			level = maxLevels - 1
+		}
+		levels[level] = append(levels[level], t)
+	}
+	return levels, nil
+}
+
+// loadTableInfo reads the size and properties of a SSTable
+func loadTableInfo(dir string, ref sstableRef) (*tableInfo, error) {
+
+	info := &tableInfo{sstableRef: ref}
+
+	fi, err := os.Stat(filepath.Join(dir, "data.db"))
+	if err != nil {
+		return nil, err
+	}
+	info.size = fi.Size()
+
+	p, err := readTableProperties(dir)
+	if err != nil {
+		return nil, err
+	}
+	info.setProperties(p)
+	return info, nil
+}
+
+func (t *tableInfo) setProperties(p *pb.TableProperties) {
+	t.entries = int(p.Entries)
+	t.smallest = p.Smallest
+	t.largest = p.Largest
+	t.minSequence = p.MinSequence
+	t.maxSequence = p.MaxSequence
+}
+
+type leveledCompaction struct {
+	cfg CompactionConfiguration
+	// for each level the largest key of the last compaction, used to rotate which SSTable is compacted next.
+	compactPointer map[int][]byte
+}
+
+func (c *leveledCompaction) pick(levels [][]*tableInfo) *compactionTask {
+
+	cfg := c.cfg
+
+	// the level with the highest score is compacted, a score of 1 or more means the level is full.
+	bestLevel := -1
+	bestScore := 1.0
+
+	if score := float64(len(levels[0])) / float64(cfg.Level0Trigger); score >= bestScore {
+		bestLevel, bestScore = 0, score
+	}
+
+	// the last level can't be compacted further
+	for level := 1; level < len(levels)-1; level++ {
+
+		size := int64(0)
+		for _, t := range levels[level] {
+			size += t.size
+		}
+
+		if score := float64(size) / cfg.maxLevelSize(level); score > bestScore {
+			bestLevel, bestScore = level, score
+		}
+	}
+
+	if bestLevel < 0 || len(levels[bestLevel]) == 0 {
+		return nil
+	}
+
+	task := &compactionTask{
+		level:         bestLevel,
+		outputLevel:   bestLevel + 1,
+		maxOutputSize: cfg.TargetFileSize,
+	}
+
+	if bestLevel == 0 {
+		task.inputs = append(task.inputs, levels[0]...)
+	} else {
+		task.inputs = append(task.inputs, c.nextTableToCompact(levels[bestLevel]))
+	}
+
+	smallest, largest := keyRange(task.inputs)
+	task.inputs = append(task.inputs, overlapping(levels[task.outputLevel], smallest, largest)...)
+
+	// the key range may have grown after including the SSTables of the output level
+	smallest, largest = keyRange(task.inputs)
+	task.bottommost = true
+	for level := task.outputLevel + 1; level < len(levels); level++ {
+		if len(overlapping(levels[level], smallest, largest)) > 0 {
+			task.bottommost = false
+		}
+	}
+
+	c.compactPointer[task.level] = largest
+	return task
+}
+
+// nextTableToCompact returns the first SSTable after the SSTable that was compacted last in the level.
+// This ensures that the whole keyspace of the level is compacted over time.
+func (c *leveledCompaction) nextTableToCompact(tables []*tableInfo) *tableInfo {
+
+	pointer := c.compactPointer[tables[0].level]
+	for _, t := range tables {
+		if pointer == nil || bytes.Compare(t.smallest, pointer) > 0 {
+			return t
+		}
+	}
+	return tables[0]
+}
+
+func keyRange(tables []*tableInfo) ([]byte, []byte) {
+
+	var smallest, largest []byte
+	for _, t := range tables {
+		if smallest == nil || bytes.Compare(t.smallest, smallest) < 0 {
+			smallest = t.smallest
+		}
+		if largest == nil || bytes.Compare(t.largest, largest) > 0 {
+			largest = t.largest
+		}
+	}
+	return smallest, largest
+}
+
+func overlapping(tables []*tableInfo, smallest, largest []byte) []*tableInfo {
+
+	res := make([]*tableInfo, 0)
+	for _, t := range tables {
+		if t.overlaps(smallest, largest) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// compact merges the inputs of the task into new SSTables in the output level.
+//
+// The new SSTables are written to temporary directories and swapped with the inputs by a single edit of the manifest
+// while holding the write lock, so a read either sees the inputs or the output of the compaction.
+func (l *LSMTree) compact(task *compactionTask) error {
+
+	dataDir := l.Configuration.DataDir
+
+	// a single SSTable without overlap in the output level is moved instead of rewritten
+	if len(task.inputs) == 1 && task.outputLevel != task.level {
+		in := task.inputs[0]
+
+		moved := *in
+		moved.level = task.outputLevel
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.apply([]*tableInfo{&moved}, []*tableInfo{in})
+	}
+
+	outputs, err := l.mergeTables(task)
+	if err == nil && l.closed() {
+		err = ErrClosed
+	}
+
+	if err != nil {
+		for _, out := range outputs {
+			os.RemoveAll(filepath.Join(dataDir, fmt.Sprintf("%s%d", tmpPrefix, out.generation)))
+		}
+		return fmt.Errorf("[compact] error merging level %d: %w", task.level, err)
+	}
+
+	// the outputs are not read until they are added to the manifest, if the edit is never appended they are removed on open.
+	for _, out := range outputs {
+		tmp := filepath.Join(dataDir, fmt.Sprintf("%s%d", tmpPrefix, out.generation))
+		if err := os.Rename(tmp, filepath.Join(dataDir, out.name)); err != nil {
+			return fmt.Errorf("[compact] fatal: %w", err)
+		}
+
+		if task.keepGeneration {
+			out.generation = task.inputs[0].generation
+		}
+	}
+
+	if err := syncDir(dataDir); err != nil {
+		return fmt.Errorf("[compact] fatal: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.apply(outputs, task.inputs); err != nil {
+		return fmt.Errorf("[compact] fatal: %w", err)
+	}
+
+	for _, in := range task.inputs {
+		l.tableCache.evict(filepath.Join(dataDir, in.name))
+		if err := os.RemoveAll(filepath.Join(dataDir, in.name)); err != nil {
+			return fmt.Errorf("[compact] fatal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// retain returns the versions of a key which are visible to a read, either at the latest sequence or at the sequence of a snapshot.
+// versions are ordered from the most recent to the oldest, and snapshots in ascending order.
+func retain(versions []*pb.Mutation, rts []*pb.RangeTombstone, snapshots []uint64) []*pb.Mutation {
+
+	retained := make([]*pb.Mutation, 0, len(versions))
+
+	points := append([]uint64{math.MaxUint64}, snapshots...)
+	for i, v := range versions {
+
+		// the range of sequences for which v is the most recent version
+		newer := uint64(math.MaxUint64)
+		if i > 0 {
+			newer = versions[i-1].Sequence
+		}
+
+		for _, p := range points {
+			if p < v.Sequence || (i > 0 && p >= newer) {
+				continue
+			}
+			// the version is deleted at p, older versions are deleted as well
+			if shadowSequence(rts, v.Key, p) > v.Sequence {
+				continue
+			}
+			retained = append(retained, v)
+			break
+		}
+	}
+	return retained
+}
+
+// mergeTables writes the merged inputs into temporary SSTables named by their generation, and returns their metadata
+func (l *LSMTree) mergeTables(task *compactionTask) ([]*tableInfo, error) {
+
+	outputs := make([]*tableInfo, 0)
+
+	expectedEntries := 0
+	sources := make([]mutationIterator, 0, len(task.inputs))
+	defer func() {
+		for _, it := range sources {
+			it.Close()
+		}
+	}()
+
+	for _, in := range task.inputs {
+		it, err := openSSTableIterator(filepath.Join(l.Configuration.DataDir, in.name))
+		if err != nil {
+			return outputs, err
+		}
+		sources = append(sources, it)
+		expectedEntries += in.entries
+	}
+
+	it := &mergeIterator{sources: sources, allVersions: true}
+	now := time.Now()
+	purgeBefore := now.Add(-l.Configuration.Compaction.TombstoneGracePeriod)
+	snapshots := l.snapshotSequences()
+
+	var sst *SSTable
+	newOutput := func() error {
+		generation := l.nextGeneration()
+		outputs = append(outputs, &tableInfo{sstableRef: sstableRef{name: sstableName(task.outputLevel, generation), level: task.outputLevel, generation: generation}})
+
+		var err error
+		sst, err = NewSSTable(filepath.Join(l.Configuration.DataDir, fmt.Sprintf("%s%d", tmpPrefix, generation)), expectedEntries, l.Configuration.SSTable)
+		return err
+	}
+
+	doneOutput := func() error {
+		if err := sst.Done(); err != nil {
+			return err
+		}
+		sst.describe(outputs[len(outputs)-1])
+		sst = nil
+		return nil
+	}
+
+	// the versions of a key are written together, so an output never splits the versions of a key
+	writeVersions := func(versions []*pb.Mutation) error {
+
+		versions = retain(versions, it.RangeTombstones(), snapshots)
+
+		for i, m := range versions {
+			if m.Tombstone == nil && expired(m, now) {
+				versions[i] = expiredTombstone(m)
+			}
+		}
+
+		// there is no older data which the oldest tombstones could shadow
+		for len(versions) > 0 && task.bottommost {
+			oldest := versions[len(versions)-1]
+			if oldest.Tombstone == nil || !oldest.Tombstone.DeletionTime.AsTime().Before(purgeBefore) {
+				break
+			}
+			versions = versions[:len(versions)-1]
+		}
+
+		if len(versions) == 0 {
+			return nil
+		}
+
+		if sst == nil {
+			if err := newOutput(); err != nil {
+				return err
+			}
+		}
+
+		for _, m := range versions {
+			if err := sst.Append(m); err != nil {
+				return err
+			}
+		}
+
+		if task.maxOutputSize > 0 && int64(sst.Size()) >= task.maxOutputSize {
+			return doneOutput()
+		}
+		return nil
+	}
+
+	versions := make([]*pb.Mutation, 0)
+	for it.Seek(nil); it.Valid(); it.Next() {
+
+		// the compaction is aborted when the LSMTree is closed
+		if l.closed() {
+			return outputs, ErrClosed
+		}
+
+		m := it.Mutation()
+		if len(versions) > 0 && !bytes.Equal(versions[0].Key, m.Key) {
+			if err := writeVersions(versions); err != nil {
+				return outputs, err
+			}
+			versions = versions[:0]
+		}
+		versions = append(versions, m)
+	}
+
+	if err := it.Err(); err != nil {
+		return outputs, err
+	}
+
+	if len(versions) > 0 {
+		if err := writeVersions(versions); err != nil {
+			return outputs, err
+		}
+	}
+
+	// the versions shadowed by the range tombstones have been dropped, but the range tombstones are kept
+	// since they still shadow versions in older SSTables.
+	for _, rt := range it.RangeTombstones() {
+
+		// a snapshot older than the range tombstone may still read the versions it shadows in other SSTables
+		if task.bottommost && rt.DeletionTime.AsTime().Before(purgeBefore) && (len(snapshots) == 0 || snapshots[0] >= rt.Sequence) {
+			continue
+		}
+
+		if sst == nil {
+			if err := newOutput(); err != nil {
+				return outputs, err
+			}
+		}
+		sst.AppendRangeTombstone(rt)
+	}
+
+	if sst != nil {
+		if err := doneOutput(); err != nil {
+			return outputs, err
+		}
+	}
+	return outputs, nil
+}
@@ -0,0 +1,159 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestLeveledCompaction(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir:    dir,
+		Compaction: CompactionConfiguration{Level0Trigger: 2},
+	})
+	assert.NoError(t, err)
+
+	older := &memtree.RBTree{}
+	older.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1")})
+	older.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("1")})
+	older.Insert(&pb.Mutation{Key: []byte("c"), Value: []byte("1")})
+	assert.NoError(t, l.flush(older))
+
+	newer := &memtree.RBTree{}
+	newer.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("2")})
+	newer.Insert(&pb.Mutation{Key: []byte("c"), Tombstone: &pb.Tombstone{DeletionTime: timestamppb.Now()}})
+	newer.Insert(&pb.Mutation{Key: []byte("d"), Value: []byte("2")})
+	assert.NoError(t, l.flush(newer))
+
+	compacted, err := l.compactOnce()
+	assert.NoError(t, err)
+	assert.True(t, compacted)
+
+	compacted, err = l.compactOnce()
+	assert.NoError(t, err)
+	assert.False(t, compacted)
+
+	tables, err := listSSTables(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+	assert.Equal(t, 1, tables[0].level)
+
+	for key, expect := range map[string]string{"a": "1", "b": "2", "d": "2"} {
+		val, err := l.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(expect), val)
+	}
+
+	// the tombstone is dropped since there is no older data left
+	_, err = l.Get([]byte("c"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	info, err := loadTableInfo(filepath.Join(dir, tables[0].name), tables[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 3, info.entries)
+}
+
+func TestSizeTieredCompaction(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir: dir,
+		Compaction: CompactionConfiguration{
+			Strategy:   SizeTieredCompaction,
+			SizeTiered: SizeTieredConfiguration{MinThreshold: 3},
+		},
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		rbt := &memtree.RBTree{}
+		rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte(fmt.Sprint(i))})
+		rbt.Insert(&pb.Mutation{Key: []byte(fmt.Sprintf("key%d", i)), Value: []byte(fmt.Sprint(i))})
+		assert.NoError(t, l.flush(rbt))
+	}
+
+	compacted, err := l.compactOnce()
+	assert.NoError(t, err)
+	assert.True(t, compacted)
+
+	tables, err := listSSTables(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+
+	// the output keeps the generation of the most recent input
+	assert.Len(t, l.version, 1)
+	assert.Equal(t, sstableRef{name: sstableName(0, 4), level: 0, generation: 3}, l.version[0].sstableRef)
+
+	val, err := l.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), val)
+
+	val, err = l.Get([]byte("key0"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0"), val)
+}
+
+func TestTombstoneGracePeriod(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir: dir,
+		Compaction: CompactionConfiguration{
+			Level0Trigger:        2,
+			TombstoneGracePeriod: time.Hour,
+		},
+	})
+	assert.NoError(t, err)
+
+	older := &memtree.RBTree{}
+	older.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1")})
+	older.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("1")})
+	assert.NoError(t, l.flush(older))
+
+	newer := &memtree.RBTree{}
+	newer.Insert(&pb.Mutation{Key: []byte("a"), Tombstone: &pb.Tombstone{DeletionTime: timestamppb.Now()}})
+	newer.Insert(&pb.Mutation{Key: []byte("b"), Tombstone: &pb.Tombstone{DeletionTime: timestamppb.New(time.Now().Add(-2 * time.Hour))}})
+	assert.NoError(t, l.flush(newer))
+
+	compacted, err := l.compactOnce()
+	assert.NoError(t, err)
+	assert.True(t, compacted)
+
+	tables, err := listSSTables(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+
+	// the tombstone of b is older than the grace period and is purged
+	it, err := openSSTableIterator(filepath.Join(dir, tables[0].name))
+	assert.NoError(t, err)
+	defer it.Close()
+
+	it.Seek(nil)
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("a"), it.Mutation().Key)
+	assert.NotNil(t, it.Mutation().Tombstone)
+
+	it.Next()
+	assert.False(t, it.Valid())
+
+	for _, key := range []string{"a", "b"} {
+		_, err = l.Get([]byte(key))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	}
+}
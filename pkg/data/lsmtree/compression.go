@@ -0,0 +1,127 @@
+package lsmtree
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses the blocks of a SSTable
+type Codec interface {
+	// Encode appends the compressed src to dst
+	Encode(dst, src []byte) ([]byte, error)
+	// Decode appends the decompressed src to dst
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+// CompressionType identifies the codec of a block, it is stored with every block so a SSTable can be read
+// after the compression of the configuration has changed.
+type CompressionType uint8
+
+const (
+	NoCompression CompressionType = iota
+	SnappyCompression
+	ZstdCompression
+)
+
+var (
+	codecs = map[CompressionType]Codec{
+		NoCompression:     noCodec{},
+		SnappyCompression: snappyCodec{},
+		ZstdCompression:   &zstdCodec{},
+	}
+	compressionNames = map[string]CompressionType{
+		"none":   NoCompression,
+		"snappy": SnappyCompression,
+		"zstd":   ZstdCompression,
+	}
+)
+
+// RegisterCodec adds a codec which is used when the compression of the configuration is name.
+// The type is stored in the blocks, so it must not be changed once SSTables are written with the codec.
+// Codecs must be registered before any SSTable is written or read.
+func RegisterCodec(t CompressionType, name string, c Codec) {
+	codecs[t] = c
+	compressionNames[name] = t
+}
+
+// parseCompression returns the compression type with the name
+func parseCompression(name string) (CompressionType, error) {
+
+	t, ok := compressionNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown compression '%s'", name)
+	}
+	return t, nil
+}
+
+func getCodec(t CompressionType) (Codec, error) {
+
+	c, ok := codecs[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression type %d", t)
+	}
+	return c, nil
+}
+
+type noCodec struct{}
+
+func (noCodec) Encode(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func (noCodec) Decode(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Encode(dst, src []byte) ([]byte, error) {
+	return append(dst, snappy.Encode(nil, src)...), nil
+}
+
+func (snappyCodec) Decode(dst, src []byte) ([]byte, error) {
+
+	b, err := snappy.Decode(nil, src)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, b...), nil
+}
+
+// zstdCodec creates the encoder and decoder on first use, they are safe for concurrent use.
+type zstdCodec struct {
+	once sync.Once
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+	err  error
+}
+
+func (c *zstdCodec) init() error {
+
+	c.once.Do(func() {
+		if c.enc, c.err = zstd.NewWriter(nil); c.err != nil {
+			return
+		}
+		c.dec, c.err = zstd.NewReader(nil)
+	})
+	return c.err
+}
+
+func (c *zstdCodec) Encode(dst, src []byte) ([]byte, error) {
+
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.enc.EncodeAll(src, dst), nil
+}
+
+func (c *zstdCodec) Decode(dst, src []byte) ([]byte, error) {
+
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.dec.DecodeAll(src, dst)
+}
@@ -1 +1,225 @@
 package lsmtree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// tableReader reads the blocks of the data file of a SSTable
+type tableReader struct {
+	f       *os.File
+	index   []*pb.IndexEntry
+	entries uint64
+	// the range tombstones of the SSTable ordered by their start
+	rangeTombstones []*pb.RangeTombstone
+
+	// set if the data blocks are cached, see tableCache
+	blocks *blockCache
+	id     uint64
+}
+
+// openTable reads the footer and the index of the data file in dir
+func openTable(dir string) (*tableReader, error) {
+
+	f, err := os.Open(filepath.Join(dir, "data.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	t, version, err := readTable(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("[openTable] error reading %s: %w", dir, err)
+	}
+
+	// the range tombstones of version 1 SSTables are stored in a separate file
+	if version == 1 {
+		if t.rangeTombstones, err = readLegacyRangeTombstones(dir); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("[openTable] error reading %s: %w", dir, err)
+		}
+	}
+	return t, nil
+}
+
+// readTable reads the footer, the index and the range tombstones of the data file and returns the format version of the file
+func readTable(f *os.File) (*tableReader, uint32, error) {
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if fi.Size() < legacyFooterSize {
+		return nil, 0, fmt.Errorf("%w: file too short", ErrCorruptSSTable)
+	}
+
+	b := make([]byte, min(fi.Size(), footerSize))
+	if _, err := f.ReadAt(b, fi.Size()-int64(len(b))); err != nil {
+		return nil, 0, err
+	}
+
+	footer, err := unmarshalFooter(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	block, err := readBlock(f, footer.index)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	index, err := decodeIndex(block)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	t := &tableReader{f: f, index: index, entries: footer.entries}
+	if footer.rangeTombstones != nil {
+		block, err := readBlock(f, footer.rangeTombstones)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if t.rangeTombstones, err = decodeRangeTombstones(block); err != nil {
+			return nil, 0, err
+		}
+	}
+	return t, footer.version, nil
+}
+
+// readBlock returns the mutations of the i:th data block
+func (t *tableReader) readBlock(i int) ([]*pb.Mutation, error) {
+
+	if t.blocks != nil {
+		if ms, ok := t.blocks.get(blockKey{table: t.id, block: i}); ok {
+			return ms, nil
+		}
+	}
+
+	block, err := readBlock(t.f, t.index[i])
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := decodeMutations(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.blocks != nil {
+		t.blocks.add(blockKey{table: t.id, block: i}, ms, int64(len(block)))
+	}
+	return ms, nil
+}
+
+// seekBlock returns the first block which may contain key. Since the versions of a key may span multiple blocks,
+// this is the block before the first block starting with a key greater than or equal to key.
+func (t *tableReader) seekBlock(key []byte) int {
+
+	i := sort.Search(len(t.index), func(i int) bool {
+		return bytes.Compare(t.index[i].Key, key) >= 0
+	})
+
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+func (t *tableReader) Close() error {
+	return t.f.Close()
+}
+
+// sstableIterator reads the entries of a SSTable in key order.
+//
+// The data file is kept open while iterating, so the iterator can still be used after the SSTable has been removed by a compaction.
+type sstableIterator struct {
+	t *tableReader
+	// the current block and the position within it
+	block     int
+	mutations []*pb.Mutation
+	pos       int
+	err       error
+
+	rangeTombstones []*pb.RangeTombstone
+	// releases the table if it is opened by the table cache
+	close func() error
+}
+
+func openSSTableIterator(dir string) (*sstableIterator, error) {
+
+	t, err := openTable(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &sstableIterator{t: t, rangeTombstones: t.rangeTombstones}, nil
+}
+
+// Seek positions the iterator at the first key greater than or equal to key
+func (it *sstableIterator) Seek(key []byte) {
+
+	it.mutations = nil
+	if len(it.t.index) == 0 {
+		return
+	}
+
+	it.load(it.t.seekBlock(key))
+	for it.Valid() && bytes.Compare(it.Mutation().Key, key) < 0 {
+		it.Next()
+	}
+}
+
+// load reads the i:th block and positions the iterator at its first entry
+func (it *sstableIterator) load(i int) {
+
+	it.block, it.pos = i, 0
+	it.mutations, it.err = it.t.readBlock(i)
+	if it.err != nil {
+		it.err = fmt.Errorf("[sstableIterator] error reading %s: %w", it.t.f.Name(), it.err)
+	}
+}
+
+// Next moves the iterator to the next entry
+func (it *sstableIterator) Next() {
+
+	it.pos++
+	if it.pos < len(it.mutations) {
+		return
+	}
+
+	if it.block+1 < len(it.t.index) {
+		it.load(it.block + 1)
+		return
+	}
+	it.mutations = nil
+}
+
+func (it *sstableIterator) Valid() bool {
+	return it.err == nil && it.pos < len(it.mutations)
+}
+
+func (it *sstableIterator) Mutation() *pb.Mutation {
+	return it.mutations[it.pos]
+}
+
+func (it *sstableIterator) RangeTombstones() []*pb.RangeTombstone {
+	return it.rangeTombstones
+}
+
+func (it *sstableIterator) Err() error {
+	return it.err
+}
+
+func (it *sstableIterator) Close() error {
+
+	if it.close != nil {
+		return it.close()
+	}
+	return it.t.Close()
+}
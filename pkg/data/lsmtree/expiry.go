@@ -0,0 +1,25 @@
+package lsmtree
+
+import (
+	"time"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Values with an ExpireTime are hidden from reads once they have expired. Compaction replaces an expired value
+// with a tombstone deleted at the expire time, which is purged like any other tombstone once the grace period has passed.
+
+// expired returns true if the value of the mutation has expired at now
+func expired(m *pb.Mutation, now time.Time) bool {
+	return m.ExpireTime != nil && !m.ExpireTime.AsTime().After(now)
+}
+
+// expiredTombstone returns the tombstone replacing the expired value
+func expiredTombstone(m *pb.Mutation) *pb.Mutation {
+	return &pb.Mutation{
+		Key:       m.Key,
+		Tombstone: &pb.Tombstone{DeletionTime: timestamppb.New(m.ExpireTime.AsTime())},
+		Sequence:  m.Sequence,
+	}
+}
@@ -0,0 +1,75 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestExpiry(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir:    dir,
+		Compaction: CompactionConfiguration{Level0Trigger: 2},
+	})
+	assert.NoError(t, err)
+
+	older := &memtree.RBTree{}
+	older.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1"), Sequence: 1})
+	older.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("1"), Sequence: 2})
+	assert.NoError(t, l.flush(older))
+
+	expired := timestamppb.New(time.Now().Add(-time.Minute))
+	l.memTree.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("2"), Sequence: 3, ExpireTime: expired})
+	l.memTree.Insert(&pb.Mutation{Key: []byte("c"), Value: []byte("2"), Sequence: 4, ExpireTime: timestamppb.New(time.Now().Add(time.Hour))})
+
+	expect := func() {
+		// the expired value shadows the older value
+		_, err := l.Get([]byte("a"))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+
+		it, err := l.Scan(nil, nil)
+		assert.NoError(t, err)
+		defer it.Close()
+
+		keys := make([]string, 0)
+		for ; it.Valid(); it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		assert.Equal(t, []string{"b", "c"}, keys)
+	}
+
+	expect()
+
+	rbt := l.memTree
+	l.memTree = &memtree.RBTree{}
+	assert.NoError(t, l.flush(rbt))
+
+	expect()
+
+	// the expired value is turned into a tombstone, which is purged with the older value
+	compacted, err := l.compactOnce()
+	assert.NoError(t, err)
+	assert.True(t, compacted)
+
+	expect()
+
+	tables, err := listSSTables(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+
+	info, err := loadTableInfo(filepath.Join(dir, tables[0].name), tables[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.entries)
+}
@@ -0,0 +1,127 @@
+package lsmtree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/crikke/oi/pkg/bloom"
+)
+
+// Filter policy
+//
+// Every SSTable has a bloom filter of its keys, bloom.db, which lets point reads skip SSTables without the key.
+// The filters are either standard or blocked bloom filters, see the bloom package. Both are read regardless of the policy.
+// If the filter policy has a prefix extractor, the SSTable also has a bloom filter of the prefixes of its keys, prefix.db,
+// which lets ScanPrefix skip SSTables without keys with the prefix.
+//
+// The name of the prefix extractor is stored in the properties of the SSTable, the prefix filter is only used
+// if it was built by the prefix extractor of the configuration.
+
+type FilterPolicy struct {
+	// False positive rate of the bloom filters.
+	// defaults to 0.01
+	FalsePositiveRate float64
+	// If set, a bloom filter of the prefixes of the keys is built in addition to the filter of the keys.
+	PrefixExtractor PrefixExtractor
+	// If set, blocked bloom filters are built. A lookup touches a single cache line at the cost of a slightly higher false positive rate.
+	Blocked bool
+}
+
+func (f FilterPolicy) withDefaults() FilterPolicy {
+
+	if f.FalsePositiveRate <= 0 || f.FalsePositiveRate >= 1 {
+		f.FalsePositiveRate = defaultFalsePositiveRate
+	}
+	return f
+}
+
+// newFilter returns an empty filter sized for the expected number of items
+func (f FilterPolicy) newFilter(expectedItems int) (bloom.Filter, error) {
+
+	if f.Blocked {
+		return bloom.NewBlockedBloomFilter(f.FalsePositiveRate, expectedItems)
+	}
+	return bloom.NewBloomFilter(f.FalsePositiveRate, expectedItems)
+}
+
+// PrefixExtractor returns the prefix of a key.
+//
+// The prefix must be a prefix of the key, and every key starting with the prefix must have the same prefix.
+// Keys without a prefix are not added to the prefix filter.
+type PrefixExtractor interface {
+	// Name identifies the extractor, it must change if the prefixes returned by the extractor change.
+	Name() string
+	// Prefix returns the prefix of key, ok is false if key has no prefix.
+	Prefix(key []byte) (prefix []byte, ok bool)
+}
+
+// FixedPrefix returns a prefix extractor which uses the first n bytes of a key as its prefix.
+// Keys shorter than n have no prefix.
+func FixedPrefix(n int) PrefixExtractor {
+	return fixedPrefix(n)
+}
+
+type fixedPrefix int
+
+func (f fixedPrefix) Name() string {
+	return fmt.Sprintf("fixed:%d", int(f))
+}
+
+func (f fixedPrefix) Prefix(key []byte) ([]byte, bool) {
+
+	if len(key) < int(f) {
+		return nil, false
+	}
+	return key[:f], true
+}
+
+// openPrefixFilter returns the prefix filter of the SSTable in dir, nil is returned if the SSTable has none
+func openPrefixFilter(dir string) (bloom.Filter, error) {
+
+	filter, err := bloom.Open(filepath.Join(dir, "prefix.db"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return filter, nil
+}
+
+// mayContainPrefix reports if the SSTable may contain keys starting with prefix, which are within [start, end).
+// The SSTable can only be skipped if its prefix filter was built by the extractor and it has no range tombstones
+// within the range, since those shadow keys in older SSTables.
+func mayContainPrefix(t *table, extractor PrefixExtractor, prefix, start, end []byte) bool {
+
+	if extractor == nil || t.prefixFilter == nil || t.properties.PrefixExtractor != extractor.Name() {
+		return true
+	}
+
+	p, ok := extractor.Prefix(prefix)
+	if !ok {
+		return true
+	}
+
+	for _, rt := range t.rangeTombstones {
+		if bytes.Compare(rt.End, start) > 0 && (end == nil || bytes.Compare(rt.Start, end) < 0) {
+			return true
+		}
+	}
+	return t.prefixFilter.Exists(p)
+}
+
+// prefixEnd returns the smallest key greater than every key starting with prefix, nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixFilter(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir: dir,
+		SSTable: SSTableConfiguration{Filter: FilterPolicy{PrefixExtractor: FixedPrefix(3), Blocked: true}},
+	})
+	assert.NoError(t, err)
+	defer l.manifest.close()
+
+	older := &memtree.RBTree{}
+	older.Insert(&pb.Mutation{Key: []byte("aaa1"), Value: []byte("1"), Sequence: 1})
+	older.Insert(&pb.Mutation{Key: []byte("ccc1"), Value: []byte("1"), Sequence: 1})
+	assert.NoError(t, l.flush(older))
+
+	newer := &memtree.RBTree{}
+	newer.Insert(&pb.Mutation{Key: []byte("bbb1"), Value: []byte("2"), Sequence: 2})
+	newer.Insert(&pb.Mutation{Key: []byte("bbb2"), Value: []byte("2"), Sequence: 2})
+	assert.NoError(t, l.flush(newer))
+
+	it, err := l.ScanPrefix([]byte("bbb"))
+	assert.NoError(t, err)
+
+	keys := make([]string, 0)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.NoError(t, it.Err())
+	assert.NoError(t, it.Close())
+	assert.Equal(t, []string{"bbb1", "bbb2"}, keys)
+
+	// the key range of the older SSTable includes the prefix, but its prefix filter does not
+	assert.Equal(t, uint64(1), l.CacheStats().BlockMisses)
+
+	props, err := l.TableProperties()
+	assert.NoError(t, err)
+	assert.Equal(t, "fixed:3", props[0].PrefixExtractor)
+}
+
+func TestPrefixEnd(t *testing.T) {
+
+	assert.Equal(t, []byte("abd"), prefixEnd([]byte("abc")))
+	assert.Equal(t, []byte("b"), prefixEnd([]byte{'a', 0xff}))
+	assert.Nil(t, prefixEnd([]byte{0xff, 0xff}))
+}
@@ -0,0 +1,301 @@
+package lsmtree
+
+import (
+	"bytes"
+	"container/heap"
+	"time"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// Iterator iterates over keys in order.
+//
+//	for it.Seek(key); it.Valid(); it.Next() {
+//		it.Key()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator interface {
+	// Seek positions the iterator at the first key greater than or equal to key
+	Seek(key []byte)
+	// Next moves the iterator to the next key
+	Next()
+	// Valid returns false when the iterator is exhausted or an error occured
+	Valid() bool
+	Key() []byte
+	Value() []byte
+	Err() error
+	Close() error
+}
+
+// mutationIterator iterates over the mutations of a memtree or SSTable in key order, including tombstones.
+type mutationIterator interface {
+	Seek(key []byte)
+	Next()
+	Valid() bool
+	Mutation() *pb.Mutation
+	// RangeTombstones returns the range tombstones of the source, they shadow the keys of older sources.
+	RangeTombstones() []*pb.RangeTombstone
+	Err() error
+	Close() error
+}
+
+// memtreeIterator iterates a memtree which is no longer modified
+type memtreeIterator struct {
+	*memtree.Iterator
+	rangeTombstones []*pb.RangeTombstone
+}
+
+func (it memtreeIterator) RangeTombstones() []*pb.RangeTombstone {
+	return it.rangeTombstones
+}
+
+func (it memtreeIterator) Err() error {
+	return nil
+}
+
+func (it memtreeIterator) Close() error {
+	return nil
+}
+
+// sliceIterator iterates over mutations copied from the active memtree
+type sliceIterator struct {
+	mutations       []*pb.Mutation
+	rangeTombstones []*pb.RangeTombstone
+	pos             int
+}
+
+func (it *sliceIterator) RangeTombstones() []*pb.RangeTombstone {
+	return it.rangeTombstones
+}
+
+func (it *sliceIterator) Seek(key []byte) {
+	it.pos = 0
+	for it.pos < len(it.mutations) && bytes.Compare(it.mutations[it.pos].Key, key) < 0 {
+		it.pos++
+	}
+}
+
+func (it *sliceIterator) Next() {
+	it.pos++
+}
+
+func (it *sliceIterator) Valid() bool {
+	return it.pos < len(it.mutations)
+}
+
+func (it *sliceIterator) Mutation() *pb.Mutation {
+	return it.mutations[it.pos]
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
+
+// mergeIterator merges sorted sources into a single sorted sequence.
+// The sources are ordered from most recent to oldest. For each key the most recent version with a sequence less than
+// or equal to seq is returned, unless it is shadowed by a visible range tombstone of any source.
+//
+// If allVersions is set every version is returned and range tombstones are not applied, this is used by compaction
+// which decides which versions to keep.
+type mergeIterator struct {
+	sources     []mutationIterator
+	h           mergeHeap
+	current     *pb.Mutation
+	seq         uint64
+	allVersions bool
+}
+
+type mergeItem struct {
+	it       mutationIterator
+	priority int
+}
+
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	switch memtree.Compare(h[i].it.Mutation(), h[j].it.Mutation()) {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	return h[i].priority < h[j].priority
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// newMergeIterator returns an iterator over the most recent versions visible at seq
+func newMergeIterator(sources []mutationIterator, seq uint64) *mergeIterator {
+	return &mergeIterator{sources: sources, seq: seq}
+}
+
+func (it *mergeIterator) Seek(key []byte) {
+
+	it.h = it.h[:0]
+	for i, src := range it.sources {
+		src.Seek(key)
+		if src.Valid() {
+			it.h = append(it.h, mergeItem{it: src, priority: i})
+		}
+	}
+	heap.Init(&it.h)
+	it.Next()
+}
+
+// pop returns the next version and advances its source
+func (it *mergeIterator) pop() *pb.Mutation {
+
+	item := heap.Pop(&it.h).(mergeItem)
+	m := item.it.Mutation()
+
+	if item.it.Next(); item.it.Valid() {
+		heap.Push(&it.h, item)
+	}
+	return m
+}
+
+func (it *mergeIterator) Next() {
+
+	prev := it.current
+	for {
+		if it.h.Len() == 0 {
+			it.current = nil
+			return
+		}
+
+		m := it.pop()
+
+		if it.allVersions {
+			// the same version exists in multiple sources, the most recent source is returned first
+			if prev != nil && memtree.Compare(prev, m) == 0 {
+				continue
+			}
+			it.current = m
+			return
+		}
+
+		if m.Sequence > it.seq {
+			continue
+		}
+
+		// m is the most recent visible version, skip the older versions
+		for it.h.Len() > 0 && bytes.Equal(it.h[0].it.Mutation().Key, m.Key) {
+			it.pop()
+		}
+
+		if !it.shadowed(m) {
+			it.current = m
+			return
+		}
+	}
+}
+
+// shadowed returns true if a visible range tombstone of any source deletes the version
+func (it *mergeIterator) shadowed(m *pb.Mutation) bool {
+	for _, src := range it.sources {
+		if shadowSequence(src.RangeTombstones(), m.Key, it.seq) > m.Sequence {
+			return true
+		}
+	}
+	return false
+}
+
+// RangeTombstones returns the range tombstones of all sources
+func (it *mergeIterator) RangeTombstones() []*pb.RangeTombstone {
+
+	rts := make([]*pb.RangeTombstone, 0)
+	for _, src := range it.sources {
+		rts = append(rts, src.RangeTombstones()...)
+	}
+	return rts
+}
+
+func (it *mergeIterator) Valid() bool {
+	return it.current != nil && it.Err() == nil
+}
+
+func (it *mergeIterator) Mutation() *pb.Mutation {
+	return it.current
+}
+
+func (it *mergeIterator) Err() error {
+	for _, src := range it.sources {
+		if err := src.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *mergeIterator) Close() error {
+
+	var err error
+	for _, src := range it.sources {
+		if cerr := src.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// rangeIterator returns the live keys of a merged iterator within [start, end).
+// A nil end means there is no upper bound.
+type rangeIterator struct {
+	it    mutationIterator
+	start []byte
+	end   []byte
+	// values which expire before now are skipped
+	now time.Time
+}
+
+func (r *rangeIterator) Seek(key []byte) {
+	if bytes.Compare(key, r.start) < 0 {
+		key = r.start
+	}
+	r.it.Seek(key)
+	r.skipTombstones()
+}
+
+func (r *rangeIterator) Next() {
+	r.it.Next()
+	r.skipTombstones()
+}
+
+func (r *rangeIterator) skipTombstones() {
+	for r.it.Valid() && (r.it.Mutation().Tombstone != nil || expired(r.it.Mutation(), r.now)) {
+		r.it.Next()
+	}
+}
+
+func (r *rangeIterator) Valid() bool {
+	return r.it.Valid() && (r.end == nil || bytes.Compare(r.it.Mutation().Key, r.end) < 0)
+}
+
+func (r *rangeIterator) Key() []byte {
+	return r.it.Mutation().Key
+}
+
+func (r *rangeIterator) Value() []byte {
+	return r.it.Mutation().Value
+}
+
+func (r *rangeIterator) Err() error {
+	return r.it.Err()
+}
+
+func (r *rangeIterator) Close() error {
+	return r.it.Close()
+}
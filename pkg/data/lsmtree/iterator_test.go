@@ -0,0 +1,52 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestScan(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{DataDir: dir})
+	assert.NoError(t, err)
+
+	older := &memtree.RBTree{}
+	older.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1")})
+	older.Insert(&pb.Mutation{Key: []byte("c"), Value: []byte("1")})
+	older.Insert(&pb.Mutation{Key: []byte("e"), Value: []byte("1")})
+	assert.NoError(t, l.flush(older))
+
+	flushing := &memtree.RBTree{}
+	flushing.Insert(&pb.Mutation{Key: []byte("c"), Tombstone: &pb.Tombstone{DeletionTime: timestamppb.Now()}})
+	flushing.Insert(&pb.Mutation{Key: []byte("d"), Value: []byte("2")})
+	l.immutable = append(l.immutable, flushing)
+
+	l.memTree.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("3")})
+	l.memTree.Insert(&pb.Mutation{Key: []byte("e"), Value: []byte("3")})
+	l.memTree.Insert(&pb.Mutation{Key: []byte("f"), Value: []byte("3")})
+
+	it, err := l.Scan([]byte("b"), []byte("f"))
+	assert.NoError(t, err)
+	defer it.Close()
+
+	res := make(map[string]string)
+	keys := make([]string, 0)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+		res[string(it.Key())] = string(it.Value())
+	}
+	assert.NoError(t, it.Err())
+
+	assert.Equal(t, []string{"b", "d", "e"}, keys)
+	assert.Equal(t, map[string]string{"b": "3", "d": "2", "e": "3"}, res)
+}
@@ -1,81 +1,686 @@
 package lsmtree
 
 import (
+	"bytes"
 	"errors"
-	"unsafe"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
 	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/proto"
 )
 
 type Configuration struct {
 	DataDir        string
 	MemtreeMaxSize uint32
+	Compaction     CompactionConfiguration
+	SSTable        SSTableConfiguration
+	Cache          CacheConfiguration
+	// FlushCallback is called with the LSN of the most recent record of a memtree once the memtree is durably written to a SSTable.
+	// Memtrees are flushed in order, so every record up to the LSN is persisted.
+	FlushCallback func(lsn uint64) error
+	// Sequence of the most recent mutation persisted to the SSTables, reads of the LSMTree see every mutation up to it.
+	Sequence uint64
+}
+
+const (
+	defaultFlushRetryInterval = 100 * time.Millisecond
+	maxFlushRetryInterval     = 10 * time.Second
+)
+
+// ErrClosed is returned when appending to a closed LSMTree
+var ErrClosed = errors.New("lsmtree closed")
+
+type appendRequest struct {
+	lsn   uint64
+	batch []*pb.Mutation
+	// closed once the batch is inserted into the memtree
+	done chan struct{}
+}
+
+type flushRequest struct {
+	// nil if there was nothing to flush
+	rbt *memtree.RBTree
+	// receives the result of the flush if set
+	done chan error
 }
 
 type LSMTree struct {
-	appendCh      chan *pb.Mutation
-	memTree       *memtree.RBTree
-	memTreeSize   uint64
+	appendCh chan appendRequest
+	flushCh  chan flushRequest
+	// forced flushes, see Flush
+	forceFlushCh chan chan error
+	compactCh    chan struct{}
+	done         chan struct{}
+	// the background loops, Close waits for them to exit
+	loops       sync.WaitGroup
+	memTree     *memtree.RBTree
+	memTreeSize uint64
+	// memtrees waiting to be flushed, ordered from most recent to oldest.
+	immutable     []*memtree.RBTree
 	Configuration *Configuration
+
+	// mu guards the memtree and the SSTables of the version.
+	// Reads hold the read lock while searching, flushes and compactions
+	// hold the write lock while applying their edit to the manifest and the version.
+	mu sync.RWMutex
+	// generation of the most recently created SSTable
+	generation uint64
+	// LSN of the most recent record written to a SSTable by this process
+	flushedLSN uint64
+	// sequence of the most recent mutation inserted into the memtree, the mutations of a record have the LSN of the record as sequence
+	sequence uint64
+	// sequences of the open snapshots, see NewSnapshot
+	snapshots map[uint64]int
+	// open SSTables and their cached blocks
+	tableCache *tableCache
+	// the initial interval between the retries of a failed flush, doubled on every retry
+	flushRetryInterval time.Duration
+	// if set, called before every flush. Used by tests to inject failures
+	flushFault func() error
+	// the SSTables of the LSMTree in the order they are searched, see sortTables. Replaced on every edit of the manifest.
+	version  []*tableInfo
+	manifest *manifest
+	strategy CompactionStrategy
+}
+
+func NewLSMTree(cfg *Configuration) (*LSMTree, error) {
+
+	t, err := newLSMTree(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("[NewLSMTree] fatal: %w", err)
+	}
+
+	t.start()
+	return t, nil
 }
 
-func NewLSMTree(cfg *Configuration) *LSMTree {
-	t := &LSMTree{Configuration: cfg}
-	t.appendCh = make(chan *pb.Mutation)
-	go t.appendLoop()
-	return t
+// start the background loops of the LSMTree
+func (t *LSMTree) start() {
+
+	t.appendCh = make(chan appendRequest)
+	t.flushCh = make(chan flushRequest, 1)
+	t.forceFlushCh = make(chan chan error)
+	t.compactCh = make(chan struct{}, 1)
+	t.done = make(chan struct{})
+	t.loops.Add(3)
+	go func() {
+		defer t.loops.Done()
+		t.appendLoop()
+	}()
+	go func() {
+		defer t.loops.Done()
+		t.flushLoop()
+	}()
+	go func() {
+		defer t.loops.Done()
+		t.compactionLoop()
+	}()
+
+	t.scheduleCompaction()
+}
+
+func newLSMTree(cfg *Configuration) (*LSMTree, error) {
+
+	strategy, err := NewCompactionStrategy(cfg.Compaction)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &LSMTree{
+		Configuration: cfg,
+		memTree:       &memtree.RBTree{},
+		strategy:      strategy,
+		sequence:      cfg.Sequence,
+		snapshots:     make(map[uint64]int),
+		tableCache:    newTableCache(cfg.Cache),
+
+		flushRetryInterval: defaultFlushRetryInterval,
+	}
+
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
-func (l *LSMTree) Append(data *pb.Mutation) error {
-	l.appendCh <- data
+// open ensures the data directory exists, replays the manifest, removes SSTables that were not completely written
+// or not added to the manifest and resumes the SSTable generation.
+func (l *LSMTree) open() error {
+
+	dataDir := l.Configuration.DataDir
+	if err := os.MkdirAll(dataDir, 0760); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), tmpPrefix) {
+			if err := os.RemoveAll(filepath.Join(dataDir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	version, err := readManifest(dataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		version, err = migrateManifest(dataDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]bool)
+	for _, t := range version {
+		live[t.name] = true
+	}
+
+	refs, err := listSSTables(dataDir)
+	if err != nil {
+		return err
+	}
+
+	// written by a flush or compaction which crashed before its edit was appended to the manifest
+	for _, ref := range refs {
+		if !live[ref.name] {
+			if err := os.RemoveAll(filepath.Join(dataDir, ref.name)); err != nil {
+				return err
+			}
+		}
+		if ref.generation > l.generation {
+			l.generation = ref.generation
+		}
+	}
+
+	if err := writeManifest(dataDir, version); err != nil {
+		return err
+	}
+
+	l.manifest, err = openManifest(dataDir)
+	if err != nil {
+		return err
+	}
+	l.version = version
 	return nil
 }
 
-func (l LSMTree) Get(key []byte) ([]byte, error) {
+// migrateManifest returns the SSTables of a data directory written before the manifest existed
+func migrateManifest(dataDir string) ([]*tableInfo, error) {
 
-	val, err := l.Get(key)
+	refs, err := listSSTables(dataDir)
 	if err != nil {
+		return nil, err
+	}
 
-		if !errors.Is(ErrKeyNotFound, err) {
+	version := make([]*tableInfo, 0, len(refs))
+	for _, ref := range refs {
+		info, err := loadTableInfo(filepath.Join(dataDir, ref.name), ref)
+		if err != nil {
 			return nil, err
 		}
+		version = append(version, info)
+	}
+	sortTables(version)
+	return version, nil
+}
+
+// apply appends the edit to the manifest and replaces the version with the result of the edit. l.mu must be held.
+func (l *LSMTree) apply(added []*tableInfo, deleted []*tableInfo) error {
+
+	edit := &pb.VersionEdit{}
+	removed := make(map[string]bool)
+	for _, t := range deleted {
+		edit.Deleted = append(edit.Deleted, t.name)
+		removed[t.name] = true
+	}
+	for _, t := range added {
+		edit.Added = append(edit.Added, t.metadata())
+	}
+
+	if err := l.manifest.apply(edit); err != nil {
+		return err
+	}
+
+	version := make([]*tableInfo, 0, len(l.version)+len(added))
+	for _, t := range l.version {
+		if !removed[t.name] {
+			version = append(version, t)
+		}
+	}
+	version = append(version, added...)
+	sortTables(version)
+
+	l.version = version
+	return nil
+}
+
+// Close stops the background loops and waits for them to exit, a running flush is completed and a running compaction is aborted.
+// Then the SSTables which are not used by open iterators and the manifest are closed.
+func (l *LSMTree) Close() error {
+	close(l.done)
+	l.loops.Wait()
+
+	l.tableCache.close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.manifest.close()
+}
+
+// CacheStats returns the hits and misses of the table and block cache
+func (l *LSMTree) CacheStats() CacheStats {
+	return l.tableCache.stats()
+}
+
+// AppendBatch inserts the mutations of the commitlog record with the LSN into the memtree at once,
+// a read either sees all or none of the mutations. Returns once the mutations are visible to reads.
+func (l *LSMTree) AppendBatch(lsn uint64, batch []*pb.Mutation) error {
+
+	req := appendRequest{
+		lsn:   lsn,
+		batch: batch,
+		done:  make(chan struct{}),
+	}
+
+	select {
+	case l.appendCh <- req:
+	case <-l.done:
+		return ErrClosed
+	}
+
+	<-req.done
+	return nil
+}
+
+func (l *LSMTree) Get(key []byte) ([]byte, error) {
+	return l.getAt(key, math.MaxUint64)
+}
+
+// getAt returns the most recent value of key with a sequence less than or equal to seq
+func (l *LSMTree) getAt(key []byte, seq uint64) ([]byte, error) {
+
+	m, shadow, err := l.lookup(key, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, ErrKeyNotFound
+	}
+	return resolve(m, shadow)
+}
+
+// LastModified returns the sequence of the most recent mutation of key, including deletes by range tombstones.
+// 0 is returned if the key has never been written, or the mutations of the key have been purged by compaction.
+func (l *LSMTree) LastModified(key []byte) (uint64, error) {
+
+	m, shadow, err := l.lookup(key, math.MaxUint64)
+	if err != nil {
+		return 0, err
+	}
+
+	if m != nil && m.Sequence > shadow {
+		return m.Sequence, nil
+	}
+	return shadow, nil
+}
+
+// lookup returns the most recent version of key with a sequence less than or equal to seq, or nil if there is none,
+// and the highest sequence of the range tombstones covering key which are visible at seq.
+func (l *LSMTree) lookup(key []byte, seq uint64) (*pb.Mutation, uint64, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	shadow := uint64(0)
+	for _, rbt := range append([]*memtree.RBTree{l.memTree}, l.immutable...) {
+
+		if s := shadowSequence(rbt.RangeTombstones, key, seq); s > shadow {
+			shadow = s
+		}
 
-		// get from sstable.
+		// older memtrees and SSTables only contain older versions
+		if m := rbt.GetAt(key, seq); m != nil {
+			return m, shadow, nil
+		}
 	}
 
-	return val, nil
+	// only the SSTables whose key range includes key, and with a mutation visible at seq, can contain a version of key
+	paths := make([]string, 0)
+	for _, t := range l.version {
+		if t.overlaps(key, key) && t.minSequence <= seq {
+			paths = append(paths, filepath.Join(l.Configuration.DataDir, t.name))
+		}
+	}
+
+	m, shadow, err := l.tableCache.lookup(paths, key, seq, shadow)
+	if err != nil {
+		return nil, 0, err
+	}
+	return m, shadow, nil
+}
+
+// Scan returns an iterator over the keys within [start, end), positioned at start.
+// A nil end means there is no upper bound.
+//
+// The iterator sees the memtrees and SSTables at the time Scan is called, later writes are not visible.
+func (l *LSMTree) Scan(start, end []byte) (Iterator, error) {
+	return l.scanAt(start, end, math.MaxUint64, nil)
+}
+
+// ScanPrefix returns an iterator over the keys starting with prefix.
+// If the filter policy has a prefix extractor, the SSTables whose prefix filter does not contain the prefix are skipped.
+func (l *LSMTree) ScanPrefix(prefix []byte) (Iterator, error) {
+	return l.scanAt(prefix, prefixEnd(prefix), math.MaxUint64, prefix)
+}
+
+// scanAt returns an iterator over the most recent versions of the keys within [start, end) with a sequence less than or equal to seq.
+// If prefix is set, every key within the range starts with prefix.
+func (l *LSMTree) scanAt(start, end []byte, seq uint64, prefix []byte) (Iterator, error) {
+
+	l.mu.RLock()
+
+	// the active memtree is still modified, so the entries within the range are copied
+	active := &sliceIterator{
+		rangeTombstones: append([]*pb.RangeTombstone{}, l.memTree.RangeTombstones...),
+	}
+	it := l.memTree.Iterator()
+	for it.Seek(start); it.Valid() && (end == nil || bytes.Compare(it.Mutation().Key, end) < 0); it.Next() {
+		active.mutations = append(active.mutations, it.Mutation())
+	}
+
+	sources := []mutationIterator{active}
+	for _, rbt := range l.immutable {
+		sources = append(sources, memtreeIterator{Iterator: rbt.Iterator(), rangeTombstones: rbt.RangeTombstones})
+	}
+
+	var err error
+	for _, t := range l.version {
+		if bytes.Compare(t.largest, start) < 0 || (end != nil && bytes.Compare(t.smallest, end) >= 0) || t.minSequence > seq {
+			continue
+		}
+
+		var sst *table
+		sst, err = l.tableCache.acquire(filepath.Join(l.Configuration.DataDir, t.name))
+		if err != nil {
+			break
+		}
+
+		if prefix != nil && !mayContainPrefix(sst, l.Configuration.SSTable.Filter.PrefixExtractor, prefix, start, end) {
+			l.tableCache.release(sst)
+			continue
+		}
+		sources = append(sources, l.tableCache.tableIterator(sst))
+	}
+	l.mu.RUnlock()
+
+	merged := newMergeIterator(sources, seq)
+	if err != nil {
+		merged.Close()
+		return nil, err
+	}
+
+	r := &rangeIterator{it: merged, start: start, end: end, now: time.Now()}
+	r.Seek(start)
+	return r, nil
 }
 
 func (l *LSMTree) appendLoop() {
 
 	for {
-		data := <-l.appendCh
+		var req appendRequest
+		select {
+		case req = <-l.appendCh:
+		case done := <-l.forceFlushCh:
+			l.rotate(done)
+			continue
+		case <-l.done:
+			return
+		}
+
+		size := uint64(0)
+		for _, data := range req.batch {
+			size += mutationSize(data)
+		}
+
+		l.checkIfNeedsFlush(size)
+
+		l.mu.Lock()
+		for _, data := range req.batch {
+			data.Sequence = req.lsn
+			if data.RangeTombstone != nil {
+				data.RangeTombstone.Sequence = req.lsn
+				l.memTree.DeleteRange(data.RangeTombstone)
+			} else {
+				l.memTree.Insert(data)
+			}
+		}
+		if req.lsn > l.sequence {
+			l.sequence = req.lsn
+		}
+		l.memTreeSize += size
+		if req.lsn > l.memTree.LSN {
+			l.memTree.LSN = req.lsn
+		}
+		l.mu.Unlock()
+
+		close(req.done)
+	}
+}
+
+func mutationSize(data *pb.Mutation) uint64 {
+	return uint64(proto.Size(data))
+}
+
+func (l *LSMTree) checkIfNeedsFlush(size uint64) {
+
+	if l.memTreeSize+size >= uint64(l.Configuration.MemtreeMaxSize) && !l.memtreeEmpty() {
+		l.rotate(nil)
+	}
+}
+
+func (l *LSMTree) memtreeEmpty() bool {
+	return l.memTree.Root == nil && len(l.memTree.RangeTombstones) == 0
+}
+
+// rotate replaces the memtree with an empty tree and schedules the flush of the memtree.
+// If the memtree is empty only done is scheduled, so it receives the result once the previous flushes are done.
+func (l *LSMTree) rotate(done chan error) {
+
+	if l.memtreeEmpty() {
+		l.schedule(flushRequest{done: done})
+		return
+	}
+
+	l.mu.Lock()
+	rbt := l.memTree
+	l.memTree = &memtree.RBTree{}
+	l.memTreeSize = 0
+	l.immutable = append([]*memtree.RBTree{rbt}, l.immutable...)
+	l.mu.Unlock()
+
+	l.schedule(flushRequest{rbt: rbt, done: done})
+}
 
-		l.checkIfNeedsFlush(data)
-		l.memTree.Insert(data)
+// schedule queues the flush request, it blocks while a failed flush is retried
+func (l *LSMTree) schedule(req flushRequest) {
+	select {
+	case l.flushCh <- req:
+	case <-l.done:
 	}
 }
 
-func (l *LSMTree) checkIfNeedsFlush(data *pb.Mutation) {
+// flushLoop writes the full memtrees to SSTables.
+// Memtrees are flushed one at a time to ensure the SSTable generations are in the same order as the memtrees.
+func (l *LSMTree) flushLoop() {
 
-	tt := data.GetTombstone().DeletionTime.AsTime()
+	for {
+		select {
+		case req := <-l.flushCh:
+			if req.rbt == nil {
+				if req.done != nil {
+					req.done <- nil
+				}
+				continue
+			}
 
-	size := uint64(len(data.Value)) + uint64(len(data.Key)) + uint64(unsafe.Sizeof(tt))
+			rbt := req.rbt
+			if !l.flushWithRetry(rbt, req.done) {
+				return
+			}
 
-	if l.memTreeSize+size >= uint64(l.Configuration.MemtreeMaxSize) {
+			if l.Configuration.FlushCallback != nil && rbt.LSN > 0 {
+				if err := l.Configuration.FlushCallback(rbt.LSN); err != nil {
+					log.Printf("[flush] callback error: %v", err)
+				}
+			}
 
-		rbt := *l.memTree
-		l.memTree = &memtree.RBTree{}
-		l.memTreeSize = 0
-		go l.flush(rbt)
+			if req.done != nil {
+				req.done <- nil
+			}
+			l.scheduleCompaction()
+		case <-l.done:
+			return
+		}
 	}
 }
 
-func (l *LSMTree) flush(rbt memtree.RBTree) error {
+// flushWithRetry flushes the memtree, retrying until it succeeds. Memtrees are flushed in order, so the memtrees
+// rotated later are not flushed, and no later LSN is reported to the FlushCallback, until the memtree is persisted.
+// The first error is sent to done. Returns false if the LSMTree was closed before the memtree was flushed.
+func (l *LSMTree) flushWithRetry(rbt *memtree.RBTree, done chan error) bool {
+
+	backoff := l.flushRetryInterval
+	for {
+		err := l.flush(rbt)
+		if err == nil {
+			return true
+		}
+		log.Printf("[flush] error, retrying in %v: %v", backoff, err)
+
+		if done != nil {
+			done <- err
+			done = nil
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-l.done:
+			return false
+		}
+
+		if backoff < maxFlushRetryInterval {
+			backoff *= 2
+		}
+	}
+}
+
+func (l *LSMTree) flush(rbt *memtree.RBTree) error {
+
+	if l.flushFault != nil {
+		if err := l.flushFault(); err != nil {
+			return err
+		}
+	}
+
+	entries := 0
+	walk(rbt, func(m *pb.Mutation) error {
+		entries++
+		return nil
+	})
+
+	generation := l.nextGeneration()
+	tmp := filepath.Join(l.Configuration.DataDir, fmt.Sprintf("%s%d", tmpPrefix, generation))
+
+	info, err := l.writeMemtree(tmp, generation, entries, rbt)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	// if the edit is not appended to the manifest, the SSTable is removed on open
+	if err := os.Rename(tmp, filepath.Join(l.Configuration.DataDir, info.name)); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := syncDir(l.Configuration.DataDir); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the SSTable must be in the manifest before the commitlog records of the memtree are removed
+	if err := l.apply([]*tableInfo{info}, nil); err != nil {
+		return err
+	}
+
+	if rbt.LSN > l.flushedLSN {
+		l.flushedLSN = rbt.LSN
+	}
+
+	// the memtree can be read from the SSTable
+	for i, t := range l.immutable {
+		if t == rbt {
+			l.immutable = append(l.immutable[:i], l.immutable[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// writeMemtree writes the memtree to a SSTable in dir
+func (l *LSMTree) writeMemtree(dir string, generation uint64, entries int, rbt *memtree.RBTree) (*tableInfo, error) {
+
+	sst, err := NewSSTable(dir, entries, l.Configuration.SSTable)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := walk(rbt, sst.Append); err != nil {
+		return nil, err
+	}
+
+	for _, rt := range rbt.RangeTombstones {
+		sst.AppendRangeTombstone(rt)
+	}
+
+	if err := sst.Done(); err != nil {
+		return nil, err
+	}
+
+	info := &tableInfo{sstableRef: sstableRef{name: sstableName(0, generation), level: 0, generation: generation}}
+	sst.describe(info)
+	return info, nil
+}
+
+// syncDir fsyncs the directory so renames within it are durable
+func syncDir(dir string) error {
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// walk visits all mutations in the tree in key order
+func walk(rbt *memtree.RBTree, fn func(m *pb.Mutation) error) error {
 
-	sst := NewSSTable(l.Configuration.DataDir)
-	defer sst.Done()
 	stack := make([]*memtree.Node, 0)
 
 	current := rbt.Root
@@ -92,7 +697,7 @@ func (l *LSMTree) flush(rbt memtree.RBTree) error {
 			el := stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 
-			if err := sst.Append(el.Data); err != nil {
+			if err := fn(el.Data); err != nil {
 				return err
 			}
 			current = el.Right
@@ -101,3 +706,11 @@ func (l *LSMTree) flush(rbt memtree.RBTree) error {
 
 	return nil
 }
+
+func (l *LSMTree) nextGeneration() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.generation++
+	return l.generation
+}
@@ -0,0 +1,66 @@
+package lsmtree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushRetry(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	flushed := make(chan uint64, 10)
+	l, err := newLSMTree(&Configuration{
+		DataDir:        dir,
+		MemtreeMaxSize: 1 << 20,
+		FlushCallback: func(lsn uint64) error {
+			flushed <- lsn
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	failures := 2
+	l.flushFault = func() error {
+		if failures > 0 {
+			failures--
+			return errors.New("injected failure")
+		}
+		return nil
+	}
+	l.flushRetryInterval = time.Millisecond
+	l.start()
+
+	assert.NoError(t, l.AppendBatch(1, []*pb.Mutation{{Key: []byte("a"), Value: []byte("1")}}))
+	assert.Error(t, l.Flush())
+
+	// the failed memtree is retried before the next memtree is flushed
+	assert.NoError(t, l.AppendBatch(2, []*pb.Mutation{{Key: []byte("b"), Value: []byte("2")}}))
+	assert.NoError(t, l.Flush())
+	assert.NoError(t, l.Close())
+
+	close(flushed)
+	lsns := make([]uint64, 0)
+	for lsn := range flushed {
+		lsns = append(lsns, lsn)
+	}
+	assert.Equal(t, []uint64{1, 2}, lsns)
+
+	l, err = newLSMTree(&Configuration{DataDir: dir})
+	assert.NoError(t, err)
+	defer l.manifest.close()
+
+	for key, expect := range map[string]string{"a": "1", "b": "2"} {
+		val, err := l.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(expect), val)
+	}
+}
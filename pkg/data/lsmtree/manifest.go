@@ -0,0 +1,238 @@
+package lsmtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/proto"
+)
+
+// The manifest records the SSTables of the LSMTree. It is a log of version edits, every flush and compaction
+// appends a single edit which adds the new SSTables and deletes the replaced SSTables, so the set of SSTables
+// changes atomically. The LSMTree replays the manifest when opened instead of listing the data directory,
+// SSTable directories which are not part of the manifest were written by an interrupted flush or compaction and are removed.
+//
+// Each edit is stored as [length: 4 bytes] [crc32: 4 bytes] [VersionEdit], integers are little endian.
+// An edit which was only partially written when the process crashed is ignored.
+//
+// When opened the manifest is rewritten as a single edit containing every SSTable, so it does not grow indefinitely.
+
+// ManifestName is the name of the manifest in the data directory
+const ManifestName = "MANIFEST"
+
+const manifestHeaderSize = 8
+
+type manifest struct {
+	f *os.File
+	// size of the manifest after the last edit which was successfully appended
+	size int64
+}
+
+// openManifest opens the manifest in dataDir for appending edits
+func openManifest(dataDir string) (*manifest, error) {
+
+	f, err := os.OpenFile(filepath.Join(dataDir, ManifestName), os.O_WRONLY|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &manifest{f: f, size: fi.Size()}, nil
+}
+
+// apply appends the edit to the manifest, returns once it is durable.
+// If the edit fails to be written it is truncated, so a retried edit is not appended after a partially written edit.
+func (m *manifest) apply(edit *pb.VersionEdit) error {
+
+	b, err := marshalEdit(edit)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.f.Write(b)
+	if err == nil {
+		err = m.f.Sync()
+	}
+
+	if err != nil {
+		if terr := m.f.Truncate(m.size); terr != nil {
+			return fmt.Errorf("[manifest] error truncating failed edit: %v: %w", terr, err)
+		}
+		return fmt.Errorf("[manifest] error writing edit: %w", err)
+	}
+
+	m.size += int64(len(b))
+	return nil
+}
+
+func (m *manifest) close() error {
+	return m.f.Close()
+}
+
+func marshalEdit(edit *pb.VersionEdit) ([]byte, error) {
+
+	data, err := proto.Marshal(edit)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, manifestHeaderSize, manifestHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(data))
+	return append(b, data...), nil
+}
+
+// readManifest replays the edits of the manifest in dataDir and returns the SSTables.
+// An error wrapping os.ErrNotExist is returned if there is no manifest.
+func readManifest(dataDir string) ([]*tableInfo, error) {
+
+	f, err := os.Open(filepath.Join(dataDir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tables := make(map[string]*tableInfo)
+	r := bufio.NewReader(f)
+	header := make([]byte, manifestHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+
+		data := make([]byte, binary.LittleEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:8]) {
+			// the edit was torn by a crash, it is only valid as the last edit
+			if _, err := r.Peek(1); err == io.EOF {
+				break
+			}
+			return nil, errors.New("[readManifest] corrupt manifest: checksum mismatch")
+		}
+
+		edit := &pb.VersionEdit{}
+		if err := proto.Unmarshal(data, edit); err != nil {
+			return nil, fmt.Errorf("[readManifest] corrupt manifest: %w", err)
+		}
+
+		for _, name := range edit.Deleted {
+			delete(tables, name)
+		}
+		for _, t := range edit.Added {
+			tables[t.Name] = tableInfoFromMetadata(t)
+		}
+	}
+
+	version := make([]*tableInfo, 0, len(tables))
+	for _, t := range tables {
+		version = append(version, t)
+	}
+	sortTables(version)
+	return version, nil
+}
+
+// writeManifest writes a new manifest to dir, containing a single edit which adds the tables.
+// An existing manifest is replaced atomically.
+func writeManifest(dir string, tables []*tableInfo) error {
+
+	edit := &pb.VersionEdit{}
+	for _, t := range tables {
+		edit.Added = append(edit.Added, t.metadata())
+	}
+
+	b, err := marshalEdit(edit)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, tmpPrefix+ManifestName)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(dir, ManifestName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func tableInfoFromMetadata(t *pb.TableMetadata) *tableInfo {
+	return &tableInfo{
+		sstableRef:  sstableRef{name: t.Name, level: int(t.Level), generation: t.Generation},
+		size:        int64(t.Size),
+		entries:     int(t.Entries),
+		smallest:    t.Smallest,
+		largest:     t.Largest,
+		minSequence: t.MinSequence,
+		maxSequence: t.MaxSequence,
+	}
+}
+
+func (t *tableInfo) metadata() *pb.TableMetadata {
+	return &pb.TableMetadata{
+		Name:        t.name,
+		Level:       uint32(t.level),
+		Generation:  t.generation,
+		Smallest:    t.smallest,
+		Largest:     t.largest,
+		MinSequence: t.minSequence,
+		MaxSequence: t.maxSequence,
+		Entries:     uint64(t.entries),
+		Size:        uint64(t.size),
+	}
+}
+
+// sortTables orders the SSTables in the order they are searched.
+//
+// Level 0 is searched first since it contains the most recent data, the SSTables of level 0 may overlap so they are
+// ordered from the most recent to the oldest. The SSTables of the other levels are ordered by key.
+func sortTables(tables []*tableInfo) {
+
+	sort.Slice(tables, func(i, j int) bool {
+		a, b := tables[i], tables[j]
+		if a.level != b.level {
+			return a.level < b.level
+		}
+		if a.level == 0 {
+			return a.generation > b.generation
+		}
+		return bytes.Compare(a.smallest, b.smallest) < 0
+	})
+}
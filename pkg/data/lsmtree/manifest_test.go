@@ -0,0 +1,58 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{DataDir: dir})
+	assert.NoError(t, err)
+
+	rbt := &memtree.RBTree{}
+	rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1"), Sequence: 1})
+	rbt.DeleteRange(&pb.RangeTombstone{Start: []byte("b"), End: []byte("d"), Sequence: 2})
+	assert.NoError(t, l.flush(rbt))
+	assert.NoError(t, l.manifest.close())
+
+	// a SSTable which was written but never added to the manifest
+	writeSSTable(t, filepath.Join(dir, sstableName(0, 5)), rbt)
+
+	// a partially written edit is ignored
+	f, err := os.OpenFile(filepath.Join(dir, ManifestName), os.O_WRONLY|os.O_APPEND, 0660)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{10, 0, 0, 0, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	l, err = newLSMTree(&Configuration{DataDir: dir})
+	assert.NoError(t, err)
+	defer l.manifest.close()
+
+	assert.Len(t, l.version, 1)
+	assert.Equal(t, sstableRef{name: sstableName(0, 1), level: 0, generation: 1}, l.version[0].sstableRef)
+	assert.Equal(t, []byte("a"), l.version[0].smallest)
+	assert.Equal(t, []byte("d"), l.version[0].largest)
+	assert.Equal(t, uint64(2), l.version[0].maxSequence)
+
+	_, err = os.Stat(filepath.Join(dir, sstableName(0, 5)))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// the generation of the removed SSTable is not reused
+	assert.Equal(t, uint64(6), l.nextGeneration())
+
+	val, err := l.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+}
@@ -2,6 +2,7 @@ package memtree
 
 import (
 	"bytes"
+	"math"
 
 	pb "github.com/crikke/oi/proto-gen/data"
 )
@@ -10,8 +11,13 @@ type color bool
 
 const red, black color = true, false
 
+// RBTree stores every version of the keys, ordered by key and then by sequence with the most recent version first.
 type RBTree struct {
 	Root *Node
+	// Range tombstones written to the tree. They shadow the versions with a lower sequence, in this tree as well as in older trees and SSTables.
+	RangeTombstones []*pb.RangeTombstone
+	// LSN of the most recent commitlog record inserted into the tree
+	LSN uint64
 }
 
 type Node struct {
@@ -22,8 +28,37 @@ type Node struct {
 	nodecolor color
 }
 
-func (t RBTree) Get(key []byte) (*pb.Mutation, error) {
-	return nil, nil
+// Compare orders mutations by key, versions of the same key are ordered from the highest sequence to the lowest.
+func Compare(a, b *pb.Mutation) int {
+
+	if c := bytes.Compare(a.Key, b.Key); c != 0 {
+		return c
+	}
+
+	switch {
+	case a.Sequence > b.Sequence:
+		return -1
+	case a.Sequence < b.Sequence:
+		return 1
+	}
+	return 0
+}
+
+// Get returns the most recent version of key or nil if the key does not exist in the tree
+func (t RBTree) Get(key []byte) *pb.Mutation {
+	return t.GetAt(key, math.MaxUint64)
+}
+
+// GetAt returns the most recent version of key with a sequence less than or equal to seq
+func (t RBTree) GetAt(key []byte, seq uint64) *pb.Mutation {
+
+	it := t.Iterator()
+	it.SeekAt(key, seq)
+
+	if it.Valid() && bytes.Equal(it.Mutation().Key, key) {
+		return it.Mutation()
+	}
+	return nil
 }
 
 // When writing a entry, in addition to storing it to disk, index the location of the key
@@ -47,7 +82,7 @@ func (t *RBTree) Insert(m *pb.Mutation) {
 	loop := true
 	for loop {
 		parent = n
-		switch bytes.Compare(m.Key, n.Data.Key) {
+		switch Compare(m, n.Data) {
 
 		case -1:
 			if n.Left != nil {
@@ -58,7 +93,8 @@ func (t *RBTree) Insert(m *pb.Mutation) {
 			}
 
 		case 0:
-			// the key has been updated TODO
+			// the key has been written twice with the same sequence, within a batch the last write wins
+			n.Data = m
 			return
 		case 1:
 			if n.Right != nil {
@@ -74,6 +110,28 @@ func (t *RBTree) Insert(m *pb.Mutation) {
 	t.validate(newNode)
 }
 
+// DeleteRange stores the range tombstone.
+//
+// The range tombstone only shadows versions with a lower sequence, so versions within the range with the
+// same sequence, written earlier in the same batch, are replaced with tombstones.
+func (t *RBTree) DeleteRange(rt *pb.RangeTombstone) {
+
+	it := t.Iterator()
+	for it.Seek(rt.Start); it.Valid() && bytes.Compare(it.Mutation().Key, rt.End) < 0; it.Next() {
+		if it.Mutation().Sequence != rt.Sequence {
+			continue
+		}
+
+		it.current.Data = &pb.Mutation{
+			Key:       it.Mutation().Key,
+			Tombstone: &pb.Tombstone{DeletionTime: rt.DeletionTime},
+			Sequence:  rt.Sequence,
+		}
+	}
+
+	t.RangeTombstones = append(t.RangeTombstones, rt)
+}
+
 // Validation cases
 // 1. If uncle is red - switch color on uncle, parent, grandparent
 // 2. if uncle is black and path forms a trinagle, rotate opposite direction
@@ -93,6 +151,7 @@ func (t *RBTree) validate(n *Node) {
 
 	x := n
 	for x != t.Root && x.parent.nodecolor == red {
+
 		if x.parent == x.parent.parent.Left {
 
 			if x.parent.parent.Right != nil && x.parent.parent.Right.nodecolor == red {
@@ -135,6 +194,9 @@ func (t *RBTree) validate(n *Node) {
 
 		}
 	}
+
+	// case 1 may have colored the root red, it has no parent to balance against
+	t.Root.nodecolor = black
 }
 
 func (t *RBTree) rotateleft(n *Node) {
@@ -165,6 +227,10 @@ func (t *RBTree) rotateright(n *Node) {
 	y := n.Left
 	n.Left = y.Right
 
+	if y.Right != nil {
+		y.Right.parent = n
+	}
+
 	y.parent = n.parent
 
 	if n.parent == nil {
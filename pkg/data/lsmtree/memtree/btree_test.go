@@ -1,8 +1,10 @@
 package memtree
 
 import (
+	"fmt"
 	"testing"
 
+	pb "github.com/crikke/oi/proto-gen/data"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,8 +32,9 @@ func TestRBInsert(t *testing.T) {
 		{
 			name: "test case 1",
 			keys: [][]byte{[]byte("bb"), []byte("aa"), []byte("cc"), []byte("a")},
+			// the root is recolored black after case 1
 			expect: []mocknode{
-				{"bb", red},
+				{"bb", black},
 				{"aa", black},
 				{"a", red},
 				{"cc", black},
@@ -59,7 +62,7 @@ func TestRBInsert(t *testing.T) {
 			rbt := &RBTree{}
 
 			for _, k := range test.keys {
-				rbt.Insert(k, nil)
+				rbt.Insert(&pb.Mutation{Key: k})
 			}
 
 			i := 0
@@ -68,7 +71,7 @@ func TestRBInsert(t *testing.T) {
 				t,
 				func(n *Node, i int) {
 					assert.Equal(t, test.expect[i].color, n.nodecolor)
-					assert.Equal(t, []byte(test.expect[i].key), n.Key)
+					assert.Equal(t, []byte(test.expect[i].key), n.Data.Key)
 				},
 				rbt.Root,
 				&i,
@@ -77,6 +80,36 @@ func TestRBInsert(t *testing.T) {
 	}
 }
 
+// TestRBInvariants inserts keys in ascending order, which repeatedly moves a red node up to the root
+func TestRBInvariants(t *testing.T) {
+
+	rbt := &RBTree{}
+	for i := 0; i < 1000; i++ {
+		rbt.Insert(&pb.Mutation{Key: []byte(fmt.Sprintf("%04d", i))})
+		assert.Equal(t, black, rbt.Root.nodecolor)
+	}
+
+	// returns the number of black nodes on every path from n to a leaf
+	var blackHeight func(n *Node) int
+	blackHeight = func(n *Node) int {
+		if n == nil {
+			return 1
+		}
+		if n.nodecolor == red {
+			assert.False(t, n.Left != nil && n.Left.nodecolor == red, "red node %s has a red child", n.Data.Key)
+			assert.False(t, n.Right != nil && n.Right.nodecolor == red, "red node %s has a red child", n.Data.Key)
+		}
+
+		left, right := blackHeight(n.Left), blackHeight(n.Right)
+		assert.Equal(t, left, right, "black height differs below %s", n.Data.Key)
+		if n.nodecolor == black {
+			left++
+		}
+		return left
+	}
+	blackHeight(rbt.Root)
+}
+
 func traverseTree(t *testing.T, assert func(*Node, int), n *Node, idx *int) {
 
 	assert(n, *idx)
@@ -91,3 +124,91 @@ func traverseTree(t *testing.T, assert func(*Node, int), n *Node, idx *int) {
 		traverseTree(t, assert, n.Right, idx)
 	}
 }
+
+func TestIterator(t *testing.T) {
+
+	rbt := &RBTree{}
+	for _, k := range []string{"d", "b", "f", "a", "c", "e", "g"} {
+		rbt.Insert(&pb.Mutation{Key: []byte(k)})
+	}
+
+	it := rbt.Iterator()
+
+	keys := ""
+	for it.Seek([]byte("bb")); it.Valid(); it.Next() {
+		keys += string(it.Mutation().Key)
+	}
+	assert.Equal(t, "cdefg", keys)
+
+	keys = ""
+	for it.Seek(nil); it.Valid(); it.Next() {
+		keys += string(it.Mutation().Key)
+	}
+	assert.Equal(t, "abcdefg", keys)
+
+	it.Seek([]byte("h"))
+	assert.False(t, it.Valid())
+
+	// insert enough keys to cause rotations in both directions
+	rbt = &RBTree{}
+	for i := 0; i < 1000; i++ {
+		rbt.Insert(&pb.Mutation{Key: []byte(fmt.Sprintf("%04d", (i*7919)%1000))})
+	}
+
+	it = rbt.Iterator()
+	i := 0
+	for it.Seek(nil); it.Valid(); it.Next() {
+		assert.Equal(t, []byte(fmt.Sprintf("%04d", i)), it.Mutation().Key)
+		i++
+	}
+	assert.Equal(t, 1000, i)
+}
+
+func TestInsertUpdatesKey(t *testing.T) {
+
+	rbt := &RBTree{}
+	rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1")})
+	rbt.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("1")})
+	rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("2")})
+
+	assert.Equal(t, []byte("2"), rbt.Get([]byte("a")).Value)
+	assert.Equal(t, []byte("1"), rbt.Get([]byte("b")).Value)
+	assert.Nil(t, rbt.Get([]byte("c")))
+}
+
+func TestVersions(t *testing.T) {
+
+	rbt := &RBTree{}
+	rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1"), Sequence: 1})
+	rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("3"), Sequence: 3})
+	rbt.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("2"), Sequence: 2})
+
+	assert.Equal(t, []byte("3"), rbt.Get([]byte("a")).Value)
+	assert.Equal(t, []byte("2"), rbt.GetAt([]byte("a"), 2).Value)
+	assert.Equal(t, []byte("1"), rbt.GetAt([]byte("a"), 1).Value)
+	assert.Nil(t, rbt.GetAt([]byte("a"), 0))
+
+	// the versions are ordered from the most recent to the oldest
+	values := make([]string, 0)
+	it := rbt.Iterator()
+	for it.Seek([]byte("a")); it.Valid(); it.Next() {
+		values = append(values, string(it.Mutation().Value))
+	}
+	assert.Equal(t, []string{"3", "2", "1"}, values)
+}
+
+func TestDeleteRange(t *testing.T) {
+
+	rbt := &RBTree{}
+	for _, k := range []string{"a", "b", "c", "d"} {
+		rbt.Insert(&pb.Mutation{Key: []byte(k), Value: []byte(k)})
+	}
+
+	rbt.DeleteRange(&pb.RangeTombstone{Start: []byte("b"), End: []byte("d")})
+
+	assert.Nil(t, rbt.Get([]byte("a")).Tombstone)
+	assert.NotNil(t, rbt.Get([]byte("b")).Tombstone)
+	assert.NotNil(t, rbt.Get([]byte("c")).Tombstone)
+	assert.Nil(t, rbt.Get([]byte("d")).Tombstone)
+	assert.Len(t, rbt.RangeTombstones, 1)
+}
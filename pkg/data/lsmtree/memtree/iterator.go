@@ -0,0 +1,74 @@
+package memtree
+
+import (
+	"math"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// Iterator visits the mutations of the tree in key order, the versions of a key from the most recent to the oldest.
+//
+// The tree must not be modified while iterating.
+type Iterator struct {
+	t       *RBTree
+	current *Node
+}
+
+func (t *RBTree) Iterator() *Iterator {
+	return &Iterator{t: t}
+}
+
+// Seek positions the iterator at the most recent version of the first key greater than or equal to key
+func (it *Iterator) Seek(key []byte) {
+	it.SeekAt(key, math.MaxUint64)
+}
+
+// SeekAt positions the iterator at the first version which is ordered after or equal to the version of key with sequence seq,
+// see Compare.
+func (it *Iterator) SeekAt(key []byte, seq uint64) {
+
+	target := &pb.Mutation{Key: key, Sequence: seq}
+
+	var found *Node
+	n := it.t.Root
+	for n != nil {
+		if Compare(n.Data, target) >= 0 {
+			found = n
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	it.current = found
+}
+
+// Next moves the iterator to the next key
+func (it *Iterator) Next() {
+
+	n := it.current
+	if n == nil {
+		return
+	}
+
+	if n.Right != nil {
+		n = n.Right
+		for n.Left != nil {
+			n = n.Left
+		}
+		it.current = n
+		return
+	}
+
+	for n.parent != nil && n == n.parent.Right {
+		n = n.parent
+	}
+	it.current = n.parent
+}
+
+func (it *Iterator) Valid() bool {
+	return it.current != nil
+}
+
+func (it *Iterator) Mutation() *pb.Mutation {
+	return it.current.Data
+}
@@ -1,6 +1,10 @@
 package memtree
 
-import "errors"
+import (
+	"errors"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+)
 
 type Configuration struct {
 
@@ -40,7 +44,7 @@ func (m *Memtree) Put(key, value []byte) error {
 	}
 
 	m.Size += len(key) + len(value)
-	m.rbt.Insert(key, value)
+	m.rbt.Insert(&pb.Mutation{Key: key, Value: value})
 
 	return nil
 }
@@ -0,0 +1,212 @@
+package lsmtree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	protoutil "github.com/crikke/oi/pkg/data"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/proto"
+)
+
+// Table properties
+//
+// The properties of a SSTable are written to properties.db once the SSTable is done. They contain the key range and
+// the sequence range of the SSTable, which lets reads skip SSTables without consulting the bloom filter or the index:
+// a SSTable is skipped if the key is outside its key range, or if every mutation of the SSTable is more recent than
+// the sequence of the read.
+//
+// SSTables written before properties.db existed have their properties computed by reading the SSTable.
+
+// TableProperties are the statistics of a SSTable
+type TableProperties struct {
+	// name of the SSTable directory
+	Name  string
+	Level int
+	// size in bytes of the data file
+	Size uint64
+	// number of mutations, including every version of a key
+	Entries         uint64
+	RangeTombstones uint64
+	// key range of the SSTable, including its range tombstones
+	Smallest []byte
+	Largest  []byte
+	// sequence range of the mutations and range tombstones
+	MinSequence uint64
+	MaxSequence uint64
+	DataBlocks  uint64
+	// size in bytes of the uncompressed data blocks
+	RawDataSize uint64
+	Compression string
+	// name of the prefix extractor of the prefix filter, empty if the SSTable has no prefix filter
+	PrefixExtractor string
+}
+
+// TableProperties returns the properties of the SSTables of the LSMTree, in the order they are searched
+func (l *LSMTree) TableProperties() ([]TableProperties, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := make([]TableProperties, 0, len(l.version))
+	for _, info := range l.version {
+
+		t, err := l.tableCache.acquire(filepath.Join(l.Configuration.DataDir, info.name))
+		if err != nil {
+			return nil, fmt.Errorf("[TableProperties] fatal: %w", err)
+		}
+
+		p := tableProperties(info.name, info.level, uint64(info.size), t.properties)
+		l.tableCache.release(t)
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// ReadTableProperties returns the properties of the SSTable in dir.
+// The level is the level the SSTable was written to, the manifest records its current level.
+func ReadTableProperties(dir string) (TableProperties, error) {
+
+	ref, err := parseSSTableName(filepath.Base(dir))
+	if err != nil {
+		return TableProperties{}, err
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "data.db"))
+	if err != nil {
+		return TableProperties{}, err
+	}
+
+	p, err := readTableProperties(dir)
+	if err != nil {
+		return TableProperties{}, err
+	}
+	return tableProperties(ref.name, ref.level, uint64(fi.Size()), p), nil
+}
+
+func tableProperties(name string, level int, size uint64, p *pb.TableProperties) TableProperties {
+	return TableProperties{
+		Name:            name,
+		Level:           level,
+		Size:            size,
+		Entries:         p.Entries,
+		RangeTombstones: p.RangeTombstones,
+		Smallest:        p.Smallest,
+		Largest:         p.Largest,
+		MinSequence:     p.MinSequence,
+		MaxSequence:     p.MaxSequence,
+		DataBlocks:      p.DataBlocks,
+		RawDataSize:     p.RawDataSize,
+		Compression:     p.Compression,
+		PrefixExtractor: p.PrefixExtractor,
+	}
+}
+
+// includes reports if the key range of the properties includes key, and the SSTable has a mutation visible at seq
+func includes(p *pb.TableProperties, key []byte, seq uint64) bool {
+	return p.MinSequence <= seq && bytes.Compare(p.Smallest, key) <= 0 && bytes.Compare(key, p.Largest) <= 0
+}
+
+func writeTableProperties(path string, p *pb.TableProperties) error {
+
+	data, err := proto.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	aof, err := newAppendOnlyFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := aof.append(protoutil.ProtoEntry{Data: data, DataLen: uint32(len(data))}); err != nil {
+		aof.close()
+		return err
+	}
+	return aof.close()
+}
+
+// readTableProperties returns the properties of the SSTable in dir
+func readTableProperties(dir string) (*pb.TableProperties, error) {
+
+	f, err := os.Open(filepath.Join(dir, "properties.db"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return computeTableProperties(dir)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	pe := &protoutil.ProtoEntry{}
+	if _, err := pe.ReadFrom(bufio.NewReader(f)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: properties: %v", ErrCorruptSSTable, err)
+	}
+
+	p := &pb.TableProperties{}
+	if err := proto.Unmarshal(pe.Data, p); err != nil {
+		return nil, fmt.Errorf("%w: properties: %v", ErrCorruptSSTable, err)
+	}
+	return p, nil
+}
+
+// computeTableProperties reads every block and the range tombstones of the SSTable in dir to compute its properties
+func computeTableProperties(dir string) (*pb.TableProperties, error) {
+
+	t, err := openTable(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	p := &pb.TableProperties{Entries: t.entries, DataBlocks: uint64(len(t.index)), MinSequence: math.MaxUint64}
+	for i := range t.index {
+		ms, err := t.readBlock(i)
+		if err != nil {
+			return nil, fmt.Errorf("[computeTableProperties] error reading %s: %w", dir, err)
+		}
+
+		for _, m := range ms {
+			includeProperties(p, m.Key, m.Key, m.Sequence)
+			// the mutations are length prefixed in the blocks
+			p.RawDataSize += uint64(proto.Size(m)) + 4
+		}
+	}
+
+	for _, rt := range t.rangeTombstones {
+		includeProperties(p, rt.Start, rt.End, rt.Sequence)
+	}
+	p.RangeTombstones = uint64(len(t.rangeTombstones))
+
+	if p.Entries == 0 && p.RangeTombstones == 0 {
+		p.MinSequence = 0
+	}
+	return p, nil
+}
+
+// includeProperties extends the key range and sequence range of the properties.
+// MinSequence must be initialized to math.MaxUint64.
+func includeProperties(p *pb.TableProperties, smallest, largest []byte, sequence uint64) {
+
+	if p.Smallest == nil || bytes.Compare(smallest, p.Smallest) < 0 {
+		p.Smallest = smallest
+	}
+	if p.Largest == nil || bytes.Compare(largest, p.Largest) > 0 {
+		p.Largest = largest
+	}
+	if sequence < p.MinSequence {
+		p.MinSequence = sequence
+	}
+	if sequence > p.MaxSequence {
+		p.MaxSequence = sequence
+	}
+}
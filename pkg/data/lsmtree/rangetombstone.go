@@ -0,0 +1,71 @@
+package lsmtree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	protoutil "github.com/crikke/oi/pkg/data"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/proto"
+)
+
+// Range tombstones
+//
+// A range tombstone deletes every key within [Start, End). Range tombstones are stored in a dedicated block of the
+// data file of the SSTable, referenced from the footer, see block.go.
+//
+// A range tombstone shadows the versions of the keys within the range which have a lower sequence, in every memtree and SSTable.
+// A read at sequence seq only sees the range tombstones with a sequence less than or equal to seq.
+
+// covers returns true if key is within the range of the tombstone
+func covers(rt *pb.RangeTombstone, key []byte) bool {
+	return bytes.Compare(rt.Start, key) <= 0 && bytes.Compare(key, rt.End) < 0
+}
+
+// shadowSequence returns the highest sequence of the range tombstones covering key which are visible at seq,
+// versions of key with a lower sequence are deleted. 0 is returned if no range tombstone covers the key.
+func shadowSequence(rts []*pb.RangeTombstone, key []byte, seq uint64) uint64 {
+
+	shadow := uint64(0)
+	for _, rt := range rts {
+		if rt.Sequence <= seq && rt.Sequence > shadow && covers(rt, key) {
+			shadow = rt.Sequence
+		}
+	}
+	return shadow
+}
+
+// readLegacyRangeTombstones returns the range tombstones of a version 1 SSTable in dir, which are stored in rangedel.db
+func readLegacyRangeTombstones(dir string) ([]*pb.RangeTombstone, error) {
+
+	f, err := os.Open(filepath.Join(dir, "rangedel.db"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	rts := make([]*pb.RangeTombstone, 0)
+	for {
+		pe := &protoutil.ProtoEntry{}
+		if _, err := pe.ReadFrom(r); err != nil {
+			if err == io.EOF {
+				return rts, nil
+			}
+			return nil, err
+		}
+
+		rt := &pb.RangeTombstone{}
+		if err := proto.Unmarshal(pe.Data, rt); err != nil {
+			return nil, err
+		}
+		rts = append(rts, rt)
+	}
+}
@@ -0,0 +1,139 @@
+package lsmtree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRangeTombstone(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir:    dir,
+		Compaction: CompactionConfiguration{Level0Trigger: 2},
+	})
+	assert.NoError(t, err)
+
+	older := &memtree.RBTree{}
+	for i, k := range []string{"tenant1/a", "tenant1/b", "tenant2/a"} {
+		older.Insert(&pb.Mutation{Key: []byte(k), Value: []byte("1"), Sequence: uint64(i + 1)})
+	}
+	assert.NoError(t, l.flush(older))
+
+	newer := &memtree.RBTree{}
+	newer.Insert(&pb.Mutation{Key: []byte("tenant1/c"), Value: []byte("2"), Sequence: 4})
+	newer.DeleteRange(&pb.RangeTombstone{Start: []byte("tenant1/"), End: []byte("tenant10"), DeletionTime: timestamppb.Now(), Sequence: 5})
+	newer.Insert(&pb.Mutation{Key: []byte("tenant1/d"), Value: []byte("2"), Sequence: 6})
+	assert.NoError(t, l.flush(newer))
+
+	expect := func() {
+		for key, value := range map[string]string{"tenant1/d": "2", "tenant2/a": "1"} {
+			val, err := l.Get([]byte(key))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(value), val)
+		}
+
+		for _, key := range []string{"tenant1/a", "tenant1/b", "tenant1/c"} {
+			_, err := l.Get([]byte(key))
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+		}
+
+		it, err := l.Scan(nil, nil)
+		assert.NoError(t, err)
+		defer it.Close()
+
+		keys := make([]string, 0)
+		for ; it.Valid(); it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		assert.Equal(t, []string{"tenant1/d", "tenant2/a"}, keys)
+	}
+
+	expect()
+
+	// a range tombstone in the active memtree shadows the flushed keys
+	l.memTree.DeleteRange(&pb.RangeTombstone{Start: []byte("tenant2/"), End: []byte("tenant20"), DeletionTime: timestamppb.Now(), Sequence: 7})
+	_, err = l.Get([]byte("tenant2/a"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	l.memTree = &memtree.RBTree{}
+
+	// the shadowed keys are dropped by compaction
+	compacted, err := l.compactOnce()
+	assert.NoError(t, err)
+	assert.True(t, compacted)
+
+	expect()
+
+	tables, err := listSSTables(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+
+	info, err := loadTableInfo(dir+"/"+tables[0].name, tables[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.entries)
+}
+
+func TestRangeTombstoneBlock(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	sst, err := NewSSTable(dir, 1, SSTableConfiguration{})
+	assert.NoError(t, err)
+	assert.NoError(t, sst.Append(&pb.Mutation{Key: []byte("a"), Value: []byte("1"), Sequence: 1}))
+	sst.AppendRangeTombstone(&pb.RangeTombstone{Start: []byte("c"), End: []byte("d"), Sequence: 3})
+	sst.AppendRangeTombstone(&pb.RangeTombstone{Start: []byte("b"), End: []byte("c"), Sequence: 2})
+	assert.NoError(t, sst.Done())
+
+	// the range tombstones are stored in the data file
+	_, err = os.Stat(filepath.Join(dir, "rangedel.db"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	tr, err := openTable(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tr.rangeTombstones, 2)
+	assert.Equal(t, []byte("b"), tr.rangeTombstones[0].Start)
+	assert.Equal(t, []byte("c"), tr.rangeTombstones[1].Start)
+	assert.NoError(t, tr.Close())
+
+	// a version 1 SSTable, with its range tombstones in rangedel.db
+	data, err := os.ReadFile(filepath.Join(dir, "data.db"))
+	assert.NoError(t, err)
+	f, err := unmarshalFooter(data[len(data)-footerSize:])
+	assert.NoError(t, err)
+
+	legacy := make([]byte, legacyFooterSize)
+	binary.LittleEndian.PutUint64(legacy[0:8], f.index.Position)
+	binary.LittleEndian.PutUint64(legacy[8:16], f.index.Size)
+	binary.LittleEndian.PutUint64(legacy[16:24], f.entries)
+	binary.LittleEndian.PutUint32(legacy[24:28], 1)
+	binary.LittleEndian.PutUint32(legacy[28:32], sstableMagic)
+	binary.LittleEndian.PutUint32(legacy[32:36], crc32.ChecksumIEEE(legacy[:32]))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "data.db"), append(data[:len(data)-footerSize], legacy...), 0660))
+
+	rangedel, err := appendEntry(nil, &pb.RangeTombstone{Start: []byte("e"), End: []byte("f"), Sequence: 4})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "rangedel.db"), rangedel, 0660))
+
+	tr, err = openTable(dir)
+	assert.NoError(t, err)
+	defer tr.Close()
+	assert.Len(t, tr.rangeTombstones, 1)
+	assert.Equal(t, []byte("e"), tr.rangeTombstones[0].Start)
+
+	ms, err := tr.readBlock(0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), ms[0].Key)
+}
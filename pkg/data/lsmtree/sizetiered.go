@@ -0,0 +1,148 @@
+package lsmtree
+
+// Size-tiered compaction
+//
+// All SSTables are kept in level 0. SSTables of similar size are grouped into buckets, once a bucket contains
+// MinThreshold SSTables they are merged into a single larger SSTable. Over time this creates tiers of SSTables
+// where each tier is roughly MinThreshold times larger than the previous tier.
+//
+// Compared to leveled compaction each key is rewritten fewer times, which suits write heavy workloads,
+// at the cost of more SSTables to search on reads.
+//
+// Since the SSTables are ordered by generation, only SSTables next to each other in generation order are bucketed
+// together. The output of the merge takes the ordering generation of the most recent input in the manifest.
+
+type SizeTieredConfiguration struct {
+	// Minimum number of SSTables in a bucket before it is compacted.
+	// defaults to 4
+	MinThreshold int
+	// Maximum number of SSTables compacted at once.
+	// defaults to 32
+	MaxThreshold int
+	// A SSTable belongs to a bucket if its size is between BucketLow and BucketHigh times the average size of the bucket.
+	// defaults to 0.5 and 1.5
+	BucketLow  float64
+	BucketHigh float64
+	// SSTables smaller than MinSSTableSize in bytes are put in the same bucket.
+	// defaults to 1mb
+	MinSSTableSize int64
+}
+
+func (c SizeTieredConfiguration) withDefaults() SizeTieredConfiguration {
+
+	if c.MinThreshold < 2 {
+		c.MinThreshold = 4
+	}
+	if c.MaxThreshold < c.MinThreshold {
+		c.MaxThreshold = 32
+	}
+	if c.BucketLow <= 0 {
+		c.BucketLow = 0.5
+	}
+	if c.BucketHigh <= c.BucketLow {
+		c.BucketHigh = 1.5
+	}
+	if c.MinSSTableSize <= 0 {
+		c.MinSSTableSize = 1 << 20
+	}
+	return c
+}
+
+type sizeTieredCompaction struct {
+	cfg SizeTieredConfiguration
+}
+
+func (c *sizeTieredCompaction) pick(levels [][]*tableInfo) *compactionTask {
+
+	// size-tiered compaction only uses level 0
+	tables := levels[0]
+
+	var best []*tableInfo
+	bestAvg := 0.0
+
+	for _, bucket := range c.buckets(tables) {
+
+		if len(bucket) < c.cfg.MinThreshold {
+			continue
+		}
+		if len(bucket) > c.cfg.MaxThreshold {
+			bucket = bucket[:c.cfg.MaxThreshold]
+		}
+
+		avg := averageSize(bucket)
+
+		// prefer the bucket with most SSTables, if equal prefer the bucket with the smallest SSTables
+		if len(bucket) > len(best) || (len(bucket) == len(best) && avg < bestAvg) {
+			best = bucket
+			bestAvg = avg
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	task := &compactionTask{
+		level:          0,
+		outputLevel:    0,
+		inputs:         best,
+		keepGeneration: true,
+	}
+
+	// tombstones can only be dropped if there is no older SSTable that overlaps the bucket
+	smallest, largest := keyRange(best)
+	oldest := best[len(best)-1].generation
+	task.bottommost = true
+	for _, t := range tables {
+		if t.generation < oldest && t.overlaps(smallest, largest) {
+			task.bottommost = false
+		}
+	}
+
+	return task
+}
+
+// buckets groups the SSTables, ordered from most recent to oldest, into buckets of adjacent SSTables with similar size.
+func (c *sizeTieredCompaction) buckets(tables []*tableInfo) [][]*tableInfo {
+
+	buckets := make([][]*tableInfo, 0)
+
+	var current []*tableInfo
+	for _, t := range tables {
+
+		if current != nil && c.fits(current, t) {
+			current = append(current, t)
+			continue
+		}
+
+		if current != nil {
+			buckets = append(buckets, current)
+		}
+		current = []*tableInfo{t}
+	}
+
+	if current != nil {
+		buckets = append(buckets, current)
+	}
+	return buckets
+}
+
+func (c *sizeTieredCompaction) fits(bucket []*tableInfo, t *tableInfo) bool {
+
+	avg := averageSize(bucket)
+	if t.size < c.cfg.MinSSTableSize && avg < float64(c.cfg.MinSSTableSize) {
+		return true
+	}
+
+	size := float64(t.size)
+	return size >= avg*c.cfg.BucketLow && size <= avg*c.cfg.BucketHigh
+}
+
+func averageSize(tables []*tableInfo) float64 {
+
+	total := int64(0)
+	for _, t := range tables {
+		total += t.size
+	}
+	return float64(total) / float64(len(tables))
+}
@@ -0,0 +1,68 @@
+package lsmtree
+
+import (
+	"sort"
+)
+
+// Snapshot is a consistent view of the LSMTree at a sequence, writes after the snapshot was created are not visible.
+// Compactions keep the versions visible to open snapshots, so a snapshot must be released once it is no longer used.
+type Snapshot struct {
+	l        *LSMTree
+	sequence uint64
+	released bool
+}
+
+// NewSnapshot returns a snapshot of the mutations inserted into the LSMTree so far
+func (l *LSMTree) NewSnapshot() *Snapshot {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.snapshots[l.sequence]++
+	return &Snapshot{l: l, sequence: l.sequence}
+}
+
+// Sequence returns the sequence of the snapshot, which is the LSN of the most recent record visible to the snapshot
+func (s *Snapshot) Sequence() uint64 {
+	return s.sequence
+}
+
+// Get returns the value of key at the time the snapshot was created
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	return s.l.getAt(key, s.sequence)
+}
+
+// Scan returns an iterator over the keys within [start, end) at the time the snapshot was created
+func (s *Snapshot) Scan(start, end []byte) (Iterator, error) {
+	return s.l.scanAt(start, end, s.sequence, nil)
+}
+
+// Release releases the snapshot, the versions only visible to the snapshot can be removed by compactions.
+func (s *Snapshot) Release() {
+
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+
+	if s.released {
+		return
+	}
+	s.released = true
+
+	if s.l.snapshots[s.sequence]--; s.l.snapshots[s.sequence] == 0 {
+		delete(s.l.snapshots, s.sequence)
+	}
+}
+
+// snapshotSequences returns the sequences of the open snapshots in ascending order
+func (l *LSMTree) snapshotSequences() []uint64 {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	seqs := make([]uint64, 0, len(l.snapshots))
+	for seq := range l.snapshots {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
@@ -0,0 +1,87 @@
+package lsmtree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	l, err := newLSMTree(&Configuration{
+		DataDir:    dir,
+		Compaction: CompactionConfiguration{Level0Trigger: 2},
+	})
+	assert.NoError(t, err)
+
+	older := &memtree.RBTree{}
+	older.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("1"), Sequence: 1})
+	older.Insert(&pb.Mutation{Key: []byte("b"), Value: []byte("1"), Sequence: 2})
+	assert.NoError(t, l.flush(older))
+	l.sequence = 2
+
+	snapshot := l.NewSnapshot()
+	defer snapshot.Release()
+	assert.Equal(t, uint64(2), snapshot.Sequence())
+
+	newer := &memtree.RBTree{}
+	newer.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("2"), Sequence: 3})
+	newer.Insert(&pb.Mutation{Key: []byte("b"), Tombstone: &pb.Tombstone{DeletionTime: timestamppb.Now()}, Sequence: 4})
+	assert.NoError(t, l.flush(newer))
+
+	// a newer version in the memtree is not visible to the snapshot
+	l.memTree.Insert(&pb.Mutation{Key: []byte("a"), Value: []byte("3"), Sequence: 5})
+	l.sequence = 5
+
+	expect := func() {
+		val, err := l.Get([]byte("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("3"), val)
+
+		_, err = l.Get([]byte("b"))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+
+		for key, expect := range map[string]string{"a": "1", "b": "1"} {
+			val, err := snapshot.Get([]byte(key))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(expect), val)
+		}
+
+		it, err := snapshot.Scan(nil, nil)
+		assert.NoError(t, err)
+		defer it.Close()
+
+		values := make([]string, 0)
+		for ; it.Valid(); it.Next() {
+			values = append(values, fmt.Sprintf("%s=%s", it.Key(), it.Value()))
+		}
+		assert.Equal(t, []string{"a=1", "b=1"}, values)
+	}
+
+	expect()
+
+	// the versions visible to the snapshot are kept by compaction
+	compacted, err := l.compactOnce()
+	assert.NoError(t, err)
+	assert.True(t, compacted)
+
+	expect()
+
+	tables, err := listSSTables(dir)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+
+	info, err := loadTableInfo(filepath.Join(dir, tables[0].name), tables[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 4, info.entries)
+}
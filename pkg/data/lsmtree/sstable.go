@@ -2,281 +2,486 @@ package lsmtree
 
 import (
 	"bufio"
-	"crypto/md5"
+	"bytes"
 	"errors"
-	"io"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/crikke/oi/pkg/bloom"
-	"github.com/crikke/oi/pkg/data"
 	protoutil "github.com/crikke/oi/pkg/data"
 	pb "github.com/crikke/oi/proto-gen/data"
-	"google.golang.org/protobuf/proto"
 )
 
-// TODO: currently the data file only stores the value
-// the data file should instead store a data struct aswell as its length.
-// this would allow data file to work without the index file and creating the index file from the data file.
-//
-// currently the index and data file are created at the same time.
-
-// TODO: SStables are currently using name for ordering.
-// this means that if a sstable is renamed, the order is changed and the data is not valid
-// so this needs to be fixed later on
-
-// index and summary have pretty much equal data structure
-
-// index depends on data file for position
-// summary depends on index for position
-//
-// Creation of new sstable:
-// create each file.
-// since SStable are immutable create or trunc existing files
-//
-// for each file create a chan
-// when inserted into data: put data offset and key into indexChannel
-// when inserted into index: put index offset and key into summaryCh
+// A SSTable is a directory containing the data file, data.db, with the mutations and range tombstones in blocks and the block index, see block.go.
+// The bloom filter of the keys is stored in bloom.db and the properties in properties.db.
+// If the filter policy has a prefix extractor, the bloom filter of the prefixes is stored in prefix.db, see filter.go.
+
+const (
+	// SSTablePrefix is the prefix of every SSTable directory. The directory is named sst_<level>_<generation> by the level it was written to,
+	// the manifest records the current level of the SSTable.
+	SSTablePrefix = "sst_"
+	// tmpPrefix is used for SSTables which are being written. They are renamed once complete
+	tmpPrefix = "tmp_"
+
+	// false positive rate of the bloom filters unless configured
+	defaultFalsePositiveRate = 0.01
+)
+
+type SSTableConfiguration struct {
+	// Size in bytes of the uncompressed data blocks. A block is written once it exceeds the size.
+	// defaults to 4kb
+	BlockSize int
+	// Compression of the blocks, either none, snappy, zstd or the name of a codec added with RegisterCodec.
+	// defaults to none
+	Compression string
+	// The bloom filters built for the SSTables
+	Filter FilterPolicy
+}
+
+func (c SSTableConfiguration) withDefaults() SSTableConfiguration {
+
+	if c.BlockSize <= 0 {
+		c.BlockSize = defaultBlockSize
+	}
+
+	if c.Compression == "" {
+		c.Compression = "none"
+	}
+	c.Filter = c.Filter.withDefaults()
+	return c
+}
 
 type SSTable struct {
 	dir string
 
-	entries    int
-	data       appendOnlyFile
-	index      appendOnlyFile
-	summary    appendOnlyFile
-	done       chan struct{}
-	sampleSize int
+	entries int
+	data    appendOnlyFile
+	filter  bloom.Filter
+
+	// set if the filter policy has a prefix extractor
+	extractor    PrefixExtractor
+	prefixFilter bloom.Filter
+	lastPrefix   []byte
+
+	blockSize   int
+	compression CompressionType
+	// the uncompressed mutations of the current block and the first key of the block
+	block    []byte
+	firstKey []byte
+	index    []*pb.IndexEntry
+
+	rangeTombstones []*pb.RangeTombstone
+
+	properties *pb.TableProperties
 }
 
 type appendOnlyFile struct {
-	w        *bufio.Writer
-	f        *os.File
-	writerCh chan protoutil.ProtoEntry
-	done     chan struct{}
-	size     uint32
+	w    *bufio.Writer
+	f    *os.File
+	size uint64
 }
 
-func newAppendOnlyFile(path string, done chan struct{}) *appendOnlyFile {
+func newAppendOnlyFile(path string) (*appendOnlyFile, error) {
 
-	aof := &appendOnlyFile{
-		done: done,
-	}
-
-	f, err := os.Open(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0660)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	aof.f = f
-	aof.w = bufio.NewWriter(f)
+	return &appendOnlyFile{
+		f: f,
+		w: bufio.NewWriter(f),
+	}, nil
+}
+
+func (a *appendOnlyFile) append(p protoutil.ProtoEntry) error {
 
-	return aof
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return a.write(b)
 }
 
-func (a *appendOnlyFile) append(p data.ProtoEntry) error {
+func (a *appendOnlyFile) write(b []byte) error {
+
+	n, err := a.w.Write(b)
+	if err != nil {
+		return err
+	}
 
-	a.writerCh <- p
+	a.size += uint64(n)
 	return nil
 }
 
-func (a *appendOnlyFile) writerLoop() {
-
-	for {
-		select {
-		case <-a.done:
-			a.w.Flush()
-			a.f.Close()
-			return
-		case p := <-a.writerCh:
-			b, _ := p.MarshalBinary()
-			n, err := a.w.Write(b)
-			if err != nil {
-				panic(err)
-			}
+func (a *appendOnlyFile) close() error {
 
-			a.size += uint32(n)
-		}
+	if err := a.w.Flush(); err != nil {
+		a.f.Close()
+		return err
 	}
+
+	if err := a.f.Sync(); err != nil {
+		a.f.Close()
+		return err
+	}
+	return a.f.Close()
 }
 
-func NewSSTable(dir string) *SSTable {
+// NewSSTable creates a new SSTable in dir. The expected number of entries is used to size the bloom filter.
+func NewSSTable(dir string, expectedEntries int, cfg SSTableConfiguration) (*SSTable, error) {
+
+	cfg = cfg.withDefaults()
+	compression, err := parseCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0760); err != nil {
+		return nil, err
+	}
+
+	filter, err := cfg.Filter.newFilter(expectedEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := &pb.TableProperties{MinSequence: math.MaxUint64, Compression: cfg.Compression}
 
-	s := &SSTable{
-		done: make(chan struct{}),
+	var prefixFilter bloom.Filter
+	if cfg.Filter.PrefixExtractor != nil {
+		// there are at most as many prefixes as keys
+		if prefixFilter, err = cfg.Filter.newFilter(expectedEntries); err != nil {
+			return nil, err
+		}
+		properties.PrefixExtractor = cfg.Filter.PrefixExtractor.Name()
+	}
+
+	data, err := newAppendOnlyFile(filepath.Join(dir, "data.db"))
+	if err != nil {
+		return nil, err
 	}
-	s.data = *newAppendOnlyFile(filepath.Join(dir, "data.db"), s.done)
-	s.index = *newAppendOnlyFile(filepath.Join(dir, "index.db"), s.done)
-	s.summary = *newAppendOnlyFile(filepath.Join(dir, "summary.db"), s.done)
 
-	return s
+	return &SSTable{
+		dir:          dir,
+		data:         *data,
+		filter:       filter,
+		blockSize:    cfg.BlockSize,
+		compression:  compression,
+		properties:   properties,
+		extractor:    cfg.Filter.PrefixExtractor,
+		prefixFilter: prefixFilter,
+	}, nil
 }
 
+// Append a mutation to the SSTable. Mutations must be appended in key order, and the versions of a key from the most recent to the oldest.
 func (s *SSTable) Append(r *pb.Mutation) error {
-	data, err := proto.Marshal(r)
 
+	if len(s.block) == 0 {
+		s.firstKey = r.Key
+	}
+
+	block, err := appendEntry(s.block, r)
 	if err != nil {
 		return err
 	}
+	s.block = block
 
-	p := protoutil.ProtoEntry{
-		Data:    data,
-		DataLen: uint32(len(data)),
+	if len(s.block) >= s.blockSize {
+		if err := s.flushBlock(); err != nil {
+			return err
+		}
 	}
 
-	pos := s.data.size
-	if err := s.data.append(p); err != nil {
-		return err
-	}
+	s.filter.Insert(r.Key)
+	s.entries++
 
-	indexEntry := pb.IndexEntry{
-		Key:      r.Key,
-		Position: uint64(pos),
+	// the keys are appended in order, so the keys with the same prefix are appended after each other
+	if s.extractor != nil {
+		if p, ok := s.extractor.Prefix(r.Key); ok && (s.lastPrefix == nil || !bytes.Equal(p, s.lastPrefix)) {
+			s.prefixFilter.Insert(p)
+			s.lastPrefix = p
+		}
 	}
+	includeProperties(s.properties, r.Key, r.Key, r.Sequence)
+	return nil
+}
+
+// flushBlock writes the current block to the data file and adds it to the index
+func (s *SSTable) flushBlock() error {
 
-	data, err = proto.Marshal(&indexEntry)
+	h, err := s.writeBlock(s.block)
 	if err != nil {
 		return err
 	}
 
-	p = protoutil.ProtoEntry{
-		Data:    data,
-		DataLen: uint32(len(data)),
+	h.Key = s.firstKey
+	s.index = append(s.index, h)
+	s.properties.RawDataSize += uint64(len(s.block))
+	s.block = s.block[:0]
+	return nil
+}
+
+// writeBlock writes the block to the data file and returns its position
+func (s *SSTable) writeBlock(block []byte) (*pb.IndexEntry, error) {
+
+	b, err := encodeBlock(block, s.compression)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.index.append(p); err != nil {
-		return err
+	h := &pb.IndexEntry{Position: s.data.size, Size: uint64(len(b))}
+	if err := s.data.write(b); err != nil {
+		return nil, err
 	}
+	return h, nil
+}
 
-	if s.entries%s.sampleSize == 0 {
-		pos = s.index.size
+// AppendRangeTombstone adds a range tombstone to the SSTable. The range tombstones are written when the SSTable is done.
+// The key range of the SSTable includes the range tombstones since they shadow keys in older SSTables.
+func (s *SSTable) AppendRangeTombstone(rt *pb.RangeTombstone) {
+	s.rangeTombstones = append(s.rangeTombstones, rt)
+	includeProperties(s.properties, rt.Start, rt.End, rt.Sequence)
+}
 
-		summaryEntry := pb.IndexEntry{
-			Key:      r.Key,
-			Position: uint64(pos),
-		}
+// Size returns the number of bytes written to the data file, including the current block
+func (s *SSTable) Size() uint64 {
+	return s.data.size + uint64(len(s.block))
+}
 
-		data, err := proto.Marshal(&summaryEntry)
-		if err != nil {
+// Done writes the last block, the index and the footer, and closes all files of the SSTable
+func (s *SSTable) Done() error {
+
+	if len(s.block) > 0 {
+		if err := s.flushBlock(); err != nil {
+			s.data.close()
 			return err
 		}
+	}
 
-		p = protoutil.ProtoEntry{
-			Data:    data,
-			DataLen: uint32(len(data)),
+	var rangeTombstones *pb.IndexEntry
+	if len(s.rangeTombstones) > 0 {
+		var err error
+		if rangeTombstones, err = s.writeRangeTombstones(); err != nil {
+			s.data.close()
+			return err
 		}
+	}
 
-		if err := s.summary.append(p); err != nil {
+	index := make([]byte, 0)
+	for _, h := range s.index {
+		var err error
+		if index, err = appendEntry(index, h); err != nil {
+			s.data.close()
 			return err
 		}
+	}
 
+	h, err := s.writeBlock(index)
+	if err != nil {
+		s.data.close()
+		return err
 	}
 
-	s.entries++
-	return nil
+	f := footer{index: h, rangeTombstones: rangeTombstones, entries: uint64(s.entries), version: sstableFormatVersion}
+	if err := s.data.write(f.marshal()); err != nil {
+		s.data.close()
+		return err
+	}
+
+	if err := s.data.close(); err != nil {
+		return err
+	}
+
+	p := s.properties
+	p.Entries = uint64(s.entries)
+	p.RangeTombstones = uint64(len(s.rangeTombstones))
+	p.DataBlocks = uint64(len(s.index))
+	if p.Entries == 0 && p.RangeTombstones == 0 {
+		p.MinSequence = 0
+	}
+
+	if err := writeTableProperties(filepath.Join(s.dir, "properties.db"), p); err != nil {
+		return err
+	}
+
+	if s.prefixFilter != nil {
+		if err := s.prefixFilter.Save(filepath.Join(s.dir, "prefix.db")); err != nil {
+			return err
+		}
+	}
+
+	return s.filter.Save(filepath.Join(s.dir, "bloom.db"))
 }
 
-func (s *SSTable) Done() error {
+// writeRangeTombstones writes the range tombstone block ordered by the start of the range tombstones
+func (s *SSTable) writeRangeTombstones() (*pb.IndexEntry, error) {
 
-	s.done <- struct{}{}
-	return nil
+	sort.Slice(s.rangeTombstones, func(i, j int) bool {
+		return bytes.Compare(s.rangeTombstones[i].Start, s.rangeTombstones[j].Start) < 0
+	})
+
+	block := make([]byte, 0)
+	for _, rt := range s.rangeTombstones {
+		var err error
+		if block, err = appendEntry(block, rt); err != nil {
+			return nil, err
+		}
+	}
+	return s.writeBlock(block)
+}
+
+// describe sets the metadata of the written SSTable
+func (s *SSTable) describe(t *tableInfo) {
+	t.size = int64(s.data.size)
+	t.setProperties(s.properties)
 }
 
 // ErrKeyNotFound if key is not found in sstable
 var ErrKeyNotFound = errors.New("key not found in SSTable")
 
-// Get value.
-// When searching for key, it will search each sstable ordered from the most recent to oldest until key is found
-func Get(dataDir string, key []byte) ([]byte, error) {
+// sstableRef identifies a SSTable directory in the data directory
+type sstableRef struct {
+	name       string
+	level      int
+	generation uint64
+}
+
+func sstableName(level int, generation uint64) string {
+	return fmt.Sprintf("%s%d_%d", SSTablePrefix, level, generation)
+}
+
+func parseSSTableName(name string) (sstableRef, error) {
+
+	parts := strings.Split(strings.TrimPrefix(name, SSTablePrefix), "_")
+	if !strings.HasPrefix(name, SSTablePrefix) || len(parts) != 2 {
+		return sstableRef{}, fmt.Errorf("invalid sstable name '%s'", name)
+	}
+
+	level, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return sstableRef{}, err
+	}
+
+	generation, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return sstableRef{}, err
+	}
+
+	return sstableRef{name: name, level: level, generation: generation}, nil
+}
+
+// listSSTables returns the SSTable directories in dataDir ordered by the level and generation in their names, newest first.
+// Only used when the data directory is loaded, the manifest is the list of the live SSTables.
+func listSSTables(dataDir string) ([]sstableRef, error) {
 
 	dirEntries, err := os.ReadDir(dataDir)
 
 	if err != nil {
 		return nil, err
 	}
-	for i := len(dirEntries) - 1; i >= 0; i-- {
 
-		entry := dirEntries[i]
+	tables := make([]sstableRef, 0, len(dirEntries))
+	for _, entry := range dirEntries {
 
-		if !entry.IsDir() {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), SSTablePrefix) {
 			continue
 		}
 
-		value, err := getFromSStable(entry.Name(), key)
+		ref, err := parseSSTableName(entry.Name())
 		if err != nil {
-			if errors.Is(err, ErrKeyNotFound) {
-				continue
-			}
 			return nil, err
 		}
-		if value != nil {
-			return value, nil
+		tables = append(tables, ref)
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].level != tables[j].level {
+			return tables[i].level < tables[j].level
 		}
+		return tables[i].generation > tables[j].generation
+	})
 
-	}
-	return nil, nil
+	return tables, nil
 }
 
-// TODO: handle checksum check
-func getFromSStable(dir string, key []byte) ([]byte, error) {
-
-	filter, err := bloom.Open(filepath.Join(dir, "bloom.db"))
+// getAt returns the most recent value of key with a sequence less than or equal to seq.
+// shadow is the sequence of the range tombstones covering key found in the memtrees.
+func (c *tableCache) getAt(paths []string, key []byte, seq uint64, shadow uint64) ([]byte, error) {
 
+	m, shadow, err := c.lookup(paths, key, seq, shadow)
 	if err != nil {
 		return nil, err
 	}
 
-	if !filter.Exists(key) {
+	if m == nil {
 		return nil, ErrKeyNotFound
 	}
+	return resolve(m, shadow)
+}
 
-	summary, err := os.Open(filepath.Join(dir, "summary.db"))
-	defer summary.Close()
-	if err != nil {
-		return nil, err
-	}
+// lookup returns the most recent version of key with a sequence less than or equal to seq, or nil if there is none,
+// and the highest sequence of the range tombstones covering key which are visible at seq.
+// The SSTables at paths are searched in order, from the most recent to the oldest.
+func (c *tableCache) lookup(paths []string, key []byte, seq uint64, shadow uint64) (*pb.Mutation, uint64, error) {
 
-	se, err := getSummaryEntry(summary, key)
+	for _, path := range paths {
 
-	if err != nil {
-		return nil, err
-	}
+		t, err := c.acquire(path)
+		if err != nil {
+			return nil, 0, err
+		}
 
-	ie, err := getIndexEntry(filepath.Join(dir, "index.db"), key, se.position)
+		if s := shadowSequence(t.rangeTombstones, key, seq); s > shadow {
+			shadow = s
+		}
 
-	if err != nil {
-		return nil, err
-	}
+		m, err := getFromSStable(t, key, seq)
+		c.release(t)
+		if err != nil {
+			if !errors.Is(err, ErrKeyNotFound) {
+				return nil, 0, err
+			}
+			continue
+		}
 
-	data, err := os.Open(filepath.Join(dir, "data.db"))
-	defer data.Close()
-	if err != nil {
-		return nil, err
+		// older sstables only contain older versions
+		return m, shadow, nil
 	}
+	return nil, shadow, nil
+}
 
-	entry, err := getDataEntry(filepath.Join(dir, "data.db"), ie.position)
+// resolve returns the value of the most recent visible version of a key
+func resolve(m *pb.Mutation, shadow uint64) ([]byte, error) {
 
-	if err != nil {
-		return nil, err
-	}
-
-	// TODO: compare checksum of data entry
-	if entry.Header.DeletionTime.IsZero() {
+	if m.Tombstone != nil || shadow > m.Sequence || expired(m, time.Now()) {
 		return nil, ErrKeyNotFound
 	}
-
-	return entry.value, nil
+	return m.Value, nil
 }
 
-// calculate the checksum for the file, this will be stored somewhere and is used to compare the index & data file
-// if the checksum does not match, the SSTable will be rebuilt from the CommitLog
-func checksum(r io.Reader) ([]byte, error) {
-	hash := md5.New()
+// getFromSStable returns the most recent version of key with a sequence less than or equal to seq
+func getFromSStable(t *table, key []byte, seq uint64) (*pb.Mutation, error) {
 
-	_, err := io.Copy(hash, r)
+	if !includes(t.properties, key, seq) || !t.filter.Exists(key) {
+		return nil, ErrKeyNotFound
+	}
 
-	if err != nil {
+	it := &sstableIterator{t: t.reader}
+	for it.Seek(key); it.Valid() && bytes.Equal(it.Mutation().Key, key); it.Next() {
+		if it.Mutation().Sequence <= seq {
+			return it.Mutation(), nil
+		}
+	}
+
+	if err := it.Err(); err != nil {
 		return nil, err
 	}
-	return hash.Sum(nil), nil
+	return nil, ErrKeyNotFound
 }
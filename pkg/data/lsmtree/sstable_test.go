@@ -1,115 +1,228 @@
 package lsmtree
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 
-	"github.com/crikke/oi/pkg/memtree"
+	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
+	pb "github.com/crikke/oi/proto-gen/data"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestEncodeEntry(t *testing.T) {
+func writeSSTable(t *testing.T, dir string, rbt *memtree.RBTree) {
 
-	str := "aaaa"
-	key := []byte(str)
-	length := uint16(len(key))
-
-	e := indexEntry{
-		key:       key,
-		keyLength: length,
-		position:  0,
-	}
-
-	b := &bytes.Buffer{}
-
-	encodeIndexEntry(b, e)
-
-	actualLength := binary.LittleEndian.Uint16(b.Next(2))
-	assert.Equal(t, e.keyLength, actualLength)
-
-	encodedStr := b.Next(int(e.keyLength))
+	sst, err := NewSSTable(dir, 4, SSTableConfiguration{})
+	assert.NoError(t, err)
 
-	assert.Equal(t, str, string(encodedStr))
+	assert.NoError(t, walk(rbt, sst.Append))
+	assert.NoError(t, sst.Done())
 }
 
-func TestCreateSSTableIndex(t *testing.T) {
+func TestCreateSSTable(t *testing.T) {
 
-	rbt := memtree.RBTree{}
+	rbt := &memtree.RBTree{}
 
 	// assert that entries are stored in order
-	rbt.Insert([]byte("bbb"), []byte("222"))
-	rbt.Insert([]byte("aaa"), []byte("111"))
-	rbt.Insert([]byte("ddd"), []byte("444"))
-	rbt.Insert([]byte("ccc"), []byte("333"))
-
-	iw := &bytes.Buffer{}
-	data := &bytes.Buffer{}
+	rbt.Insert(&pb.Mutation{Key: []byte("bbb"), Value: []byte("222")})
+	rbt.Insert(&pb.Mutation{Key: []byte("aaa"), Value: []byte("111")})
+	rbt.Insert(&pb.Mutation{Key: []byte("ddd"), Value: []byte("444")})
+	rbt.Insert(&pb.Mutation{Key: []byte("ccc"), Value: []byte("333")})
 
-	err := traverseRBTree(iw, data, rbt)
-	assert.NoError(t, err)
+	n := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(n)
 
-	// bytes are in little endian order
-	assert.Equal(t, []byte{3, 0}, iw.Next(2))
-	assert.Equal(t, []byte("aaa"), iw.Next(3))
-	assert.Equal(t, []byte{0, 0, 0, 0}, iw.Next(4))
-	assert.Equal(t, []byte{3, 0}, iw.Next(2))
+	writeSSTable(t, n, rbt)
 
-	assert.Equal(t, []byte{3, 0}, iw.Next(2))
-	assert.Equal(t, []byte("bbb"), iw.Next(3))
-	assert.Equal(t, []byte{3, 0, 0, 0}, iw.Next(4))
-	assert.Equal(t, []byte{3, 0}, iw.Next(2))
+	it, err := openSSTableIterator(n)
+	assert.NoError(t, err)
+	defer it.Close()
 
-	assert.Equal(t, []byte{3, 0}, iw.Next(2))
-	assert.Equal(t, []byte("ccc"), iw.Next(3))
-	assert.Equal(t, []byte{6, 0, 0, 0}, iw.Next(4))
-	assert.Equal(t, []byte{3, 0}, iw.Next(2))
+	keys := make([]string, 0)
+	for it.Seek(nil); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Mutation().Key))
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"aaa", "bbb", "ccc", "ddd"}, keys)
 
-	assert.Equal(t, []byte("111"), data.Next(3))
-	assert.Equal(t, []byte("222"), data.Next(3))
-	assert.Equal(t, []byte("333"), data.Next(3))
+	it.Seek([]byte("bbc"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("ccc"), it.Mutation().Key)
 
+	it.Seek([]byte("eee"))
+	assert.False(t, it.Valid())
 }
 
 func TestDecodeSSTable(t *testing.T) {
 
-	rbt := memtree.RBTree{}
+	rbt := &memtree.RBTree{}
 
-	// assert that entries are stored in order
-	rbt.Insert([]byte("bbb"), []byte("222"))
-	rbt.Insert([]byte("aaa"), []byte("111"))
-	rbt.Insert([]byte("ddd"), []byte("444"))
-	rbt.Insert([]byte("ccc"), []byte("333"))
+	rbt.Insert(&pb.Mutation{Key: []byte("bbb"), Value: []byte("222")})
+	rbt.Insert(&pb.Mutation{Key: []byte("aaa"), Value: []byte("111")})
+	rbt.Insert(&pb.Mutation{Key: []byte("ddd"), Value: []byte("444")})
+	rbt.Insert(&pb.Mutation{Key: []byte("ccc"), Value: []byte("333")})
 
 	n := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(n)
+
+	writeSSTable(t, filepath.Join(n, sstableName(0, 1)), rbt)
+
+	c := newTableCache(CacheConfiguration{})
+	defer c.close()
 
-	data, err := os.Create(fmt.Sprintf("%s.data", n))
-	if err != nil {
-		assert.NoError(t, err)
+	paths := []string{filepath.Join(n, sstableName(0, 1))}
+	get := func(key []byte) ([]byte, error) {
+		return c.getAt(paths, key, math.MaxUint64, 0)
 	}
-	defer os.Remove(data.Name())
 
-	idx, err := os.Create(fmt.Sprintf("%s.idx", n))
-	if err != nil {
-		assert.NoError(t, err)
+	val, err := get([]byte("aaa"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("111"), val)
+
+	val, err = get([]byte("ccc"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("333"), val)
+
+	_, err = get([]byte("a"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = get([]byte("eee"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestSSTableBlocks(t *testing.T) {
+
+	for _, compression := range []string{"none", "snappy", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+
+			dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+			defer os.RemoveAll(dir)
+
+			sst, err := NewSSTable(dir, 1000, SSTableConfiguration{BlockSize: 256, Compression: compression})
+			assert.NoError(t, err)
+
+			// the versions of a key span multiple blocks
+			for i := 0; i < 100; i++ {
+				for seq := 10; seq > 0; seq-- {
+					m := &pb.Mutation{Key: []byte(fmt.Sprintf("key%03d", i)), Value: []byte(fmt.Sprintf("value%d", seq)), Sequence: uint64(seq)}
+					assert.NoError(t, sst.Append(m))
+				}
+			}
+			assert.NoError(t, sst.Done())
+
+			table, err := openTable(dir)
+			assert.NoError(t, err)
+			assert.Greater(t, len(table.index), 1)
+			assert.Equal(t, uint64(1000), table.entries)
+			table.Close()
+
+			c := newTableCache(CacheConfiguration{})
+			defer c.close()
+
+			tb, err := c.acquire(dir)
+			assert.NoError(t, err)
+			defer c.release(tb)
+
+			for _, seq := range []uint64{10, 5, 1} {
+				m, err := getFromSStable(tb, []byte("key042"), seq)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte(fmt.Sprintf("value%d", seq)), m.Value)
+			}
+
+			it, err := openSSTableIterator(dir)
+			assert.NoError(t, err)
+			defer it.Close()
+
+			n := 0
+			for it.Seek([]byte("key050")); it.Valid(); it.Next() {
+				n++
+			}
+			assert.NoError(t, it.Err())
+			assert.Equal(t, 500, n)
+		})
 	}
-	defer os.Remove(idx.Name())
+}
+
+func TestCorruptSSTable(t *testing.T) {
 
-	err = traverseRBTree(idx, data, rbt)
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	rbt := &memtree.RBTree{}
+	rbt.Insert(&pb.Mutation{Key: []byte("aaa"), Value: []byte("111")})
+	writeSSTable(t, dir, rbt)
+
+	f, err := os.OpenFile(filepath.Join(dir, "data.db"), os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte("x"), 0)
 	assert.NoError(t, err)
+	f.Close()
 
-	sst, err := Open(fmt.Sprintf("%s", n))
-	defer sst.Close()
+	it, err := openSSTableIterator(dir)
 	assert.NoError(t, err)
+	defer it.Close()
+
+	it.Seek(nil)
+	assert.False(t, it.Valid())
+	assert.ErrorIs(t, it.Err(), ErrCorruptSSTable)
+}
 
+func TestTableProperties(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, sstableName(0, 1))
+	sst, err := NewSSTable(path, 2, SSTableConfiguration{Compression: "snappy"})
 	assert.NoError(t, err)
 
-	val, err := sst.Get([]byte("aaa"))
+	assert.NoError(t, sst.Append(&pb.Mutation{Key: []byte("b"), Value: []byte("1"), Sequence: 6}))
+	assert.NoError(t, sst.Append(&pb.Mutation{Key: []byte("c"), Value: []byte("1"), Sequence: 5}))
+	sst.AppendRangeTombstone(&pb.RangeTombstone{Start: []byte("d"), End: []byte("f"), Sequence: 7})
+	assert.NoError(t, sst.Done())
+
+	p, err := ReadTableProperties(path)
 	assert.NoError(t, err)
+	assert.Equal(t, sstableName(0, 1), p.Name)
+	assert.Equal(t, uint64(2), p.Entries)
+	assert.Equal(t, uint64(1), p.RangeTombstones)
+	assert.Equal(t, []byte("b"), p.Smallest)
+	assert.Equal(t, []byte("f"), p.Largest)
+	assert.Equal(t, uint64(5), p.MinSequence)
+	assert.Equal(t, uint64(7), p.MaxSequence)
+	assert.Equal(t, uint64(1), p.DataBlocks)
+	assert.Equal(t, "snappy", p.Compression)
+
+	// the properties of a SSTable without properties.db are computed from the data
+	assert.NoError(t, os.Remove(filepath.Join(path, "properties.db")))
+	computed, err := ReadTableProperties(path)
+	assert.NoError(t, err)
+	assert.Equal(t, p.RawDataSize, computed.RawDataSize)
+	assert.Equal(t, p.Smallest, computed.Smallest)
+	assert.Equal(t, p.Largest, computed.Largest)
+	assert.Equal(t, p.MinSequence, computed.MinSequence)
 
-	assert.Equal(t, []byte("111"), val)
+	c := newTableCache(CacheConfiguration{})
+	defer c.close()
 
+	tb, err := c.acquire(path)
+	assert.NoError(t, err)
+	defer c.release(tb)
+
+	// the SSTable is skipped without reading a block if the key or sequence is outside its range
+	for _, read := range []struct {
+		key string
+		seq uint64
+	}{{"a", 10}, {"g", 10}, {"b", 4}} {
+		_, err := getFromSStable(tb, []byte(read.key), read.seq)
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	}
+	assert.Equal(t, uint64(0), c.stats().BlockMisses)
+
+	m, err := getFromSStable(tb, []byte("b"), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), m.Value)
 }
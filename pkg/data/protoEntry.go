@@ -12,29 +12,37 @@ type ProtoEntry struct {
 
 func (p ProtoEntry) MarshalBinary() ([]byte, error) {
 
-	buf := make([]byte, p.DataLen+4)
+	buf := make([]byte, 4, p.DataLen+4)
 	binary.LittleEndian.PutUint32(buf[0:4], p.DataLen)
-	buf = append(buf[4:], p.Data...)
+	buf = append(buf, p.Data...)
 
 	return buf, nil
 }
 
+// ReadFrom reads a length prefixed entry from r.
+//
+// io.EOF is returned if r is empty, if the entry is only partially written io.ErrUnexpectedEOF is returned.
 func (p *ProtoEntry) ReadFrom(r io.Reader) (int64, error) {
 
 	buf := make([]byte, 4)
 	n := 0
 	var err error
-	if n, err = r.Read(buf); err != nil {
+	if n, err = io.ReadFull(r, buf); err != nil {
 		return int64(n), err
 	}
 
 	p.DataLen = binary.LittleEndian.Uint32(buf)
-	p.Data = make([]byte, p.DataLen)
 
-	n2, err := r.Read(p.Data)
+	// the data is read incrementally, so a corrupt length does not allocate more than the remaining input.
+	// If the entry is only partially written, Data holds the bytes which were read.
+	data, err := io.ReadAll(io.LimitReader(r, int64(p.DataLen)))
+	p.Data = data
 	if err != nil {
-		return int64(n + n2), err
+		return int64(n + len(data)), err
 	}
 
-	return int64(n + n2), nil
+	if len(data) < int(p.DataLen) {
+		return int64(n + len(data)), io.ErrUnexpectedEOF
+	}
+	return int64(n + len(data)), nil
 }
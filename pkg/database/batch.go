@@ -0,0 +1,93 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	pb "github.com/crikke/oi/proto-gen/data"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrInvalidRange is returned when deleting a range whose start is not before its end
+var ErrInvalidRange = errors.New("range start must be before its end")
+
+// WriteBatch collects mutations which are written to the commitlog as a single record.
+// Either all or none of the mutations in the batch are applied, also when the commitlog is replayed after a crash.
+//
+// The mutations are applied in the order they were added to the batch.
+type WriteBatch struct {
+	mutations []*pb.Mutation
+}
+
+func (b *WriteBatch) Put(key, value []byte) {
+	b.mutations = append(b.mutations, putMutation(key, value))
+}
+
+func (b *WriteBatch) Delete(key []byte) {
+	b.mutations = append(b.mutations, deleteMutation(key))
+}
+
+// DeleteRange deletes every key within [start, end). The batch is rejected when written if start is not before end.
+func (b *WriteBatch) DeleteRange(start, end []byte) {
+	b.mutations = append(b.mutations, deleteRangeMutation(start, end))
+}
+
+// Len returns the number of mutations in the batch
+func (b *WriteBatch) Len() int {
+	return len(b.mutations)
+}
+
+// Write the batch atomically
+func (db *Database) Write(ctx context.Context, b *WriteBatch) error {
+
+	if b.Len() == 0 {
+		return nil
+	}
+
+	for _, m := range b.mutations {
+		if rt := m.GetRangeTombstone(); rt != nil {
+			if err := validateRange(rt.Start, rt.End); err != nil {
+				return err
+			}
+		}
+	}
+	return db.writer.WriteBatch(b.mutations)
+}
+
+// validateRange returns ErrInvalidRange unless start is before end, a range tombstone has no open end
+func validateRange(start, end []byte) error {
+
+	if end == nil || bytes.Compare(start, end) >= 0 {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+func putMutation(key, value []byte) *pb.Mutation {
+	return &pb.Mutation{
+		Key:       key,
+		Value:     value,
+		Tombstone: nil,
+	}
+}
+
+func deleteMutation(key []byte) *pb.Mutation {
+	return &pb.Mutation{
+		Key: key,
+		Tombstone: &pb.Tombstone{
+			DeletionTime: timestamppb.Now(),
+		},
+	}
+}
+
+func deleteRangeMutation(start, end []byte) *pb.Mutation {
+	return &pb.Mutation{
+		Key: start,
+		RangeTombstone: &pb.RangeTombstone{
+			Start:        start,
+			End:          end,
+			DeletionTime: timestamppb.Now(),
+		},
+	}
+}
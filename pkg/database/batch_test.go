@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/commitlog"
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteRangeValidation(t *testing.T) {
+
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.Put(ctx, []byte("a"), []byte("1")))
+
+	assert.ErrorIs(t, db.DeleteRange(ctx, []byte("b"), []byte("a")), ErrInvalidRange)
+	assert.ErrorIs(t, db.DeleteRange(ctx, []byte("a"), []byte("a")), ErrInvalidRange)
+	assert.ErrorIs(t, db.DeleteRange(ctx, []byte("a"), nil), ErrInvalidRange)
+
+	// an invalid range rejects the whole batch
+	batch := &WriteBatch{}
+	batch.Put([]byte("b"), []byte("1"))
+	batch.DeleteRange([]byte("b"), []byte("a"))
+	assert.ErrorIs(t, db.Write(ctx, batch), ErrInvalidRange)
+
+	_, err := db.Get(ctx, []byte("b"))
+	assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+
+	assert.NoError(t, db.DeleteRange(ctx, []byte("a"), []byte("b")))
+	_, err = db.Get(ctx, []byte("a"))
+	assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+}
+
+func TestWriteBatch(t *testing.T) {
+
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "c", "d1", "f"} {
+		assert.NoError(t, db.Put(ctx, []byte(key), []byte("0")))
+	}
+
+	batch := &WriteBatch{}
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Put([]byte("b"), []byte("1"))
+	batch.Delete([]byte("c"))
+	batch.DeleteRange([]byte("d"), []byte("e"))
+	// the mutations are applied in order
+	batch.Put([]byte("b"), []byte("2"))
+	assert.NoError(t, db.Write(ctx, batch))
+
+	expect := func(db *Database) {
+		for key, value := range map[string]string{"a": "1", "b": "2", "f": "0"} {
+			val, err := db.Get(ctx, []byte(key))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(value), val)
+		}
+
+		for _, key := range []string{"c", "d1"} {
+			_, err := db.Get(ctx, []byte(key))
+			assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+		}
+	}
+	expect(db)
+
+	// the batch is replayed from the commitlog
+	expect(reopenTestDatabase(t, db))
+}
+
+func TestTornBatch(t *testing.T) {
+
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	first := &WriteBatch{}
+	first.Put([]byte("a"), []byte("1"))
+	first.Put([]byte("b"), []byte("1"))
+	assert.NoError(t, db.Write(ctx, first))
+
+	second := &WriteBatch{}
+	second.Put([]byte("a"), []byte("2"))
+	second.Put([]byte("c"), []byte("2"))
+	second.Delete([]byte("b"))
+	assert.NoError(t, db.Write(ctx, second))
+	assert.NoError(t, db.Close())
+
+	// the server crashed while the record of the second batch was written
+	segments, err := commitlog.GetTrailingSegments(db.logDir(), 0)
+	assert.NoError(t, err)
+	path := filepath.Join(db.logDir(), segments[len(segments)-1].Name())
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, fi.Size()-10))
+
+	db = reopenTestDatabase(t, db)
+	for key, value := range map[string]string{"a": "1", "b": "1"} {
+		val, err := db.Get(ctx, []byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(value), val)
+	}
+
+	_, err = db.Get(ctx, []byte("c"))
+	assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+// ErrPreconditionFailed is returned by conditional writes when the condition does not hold
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// CompareAndSwap sets key to value if the current value of key is expected, otherwise ErrPreconditionFailed is returned.
+//
+// The condition is evaluated by the commitlog writer, so it is linearizable with respect to all other writes.
+func (db *Database) CompareAndSwap(ctx context.Context, key, expected, value []byte) error {
+
+	return db.writer.WriteBatchIf([]*pb.Mutation{putMutation(key, value)}, func() error {
+
+		current, err := db.lsmTree.Get(key)
+		if err != nil {
+			if errors.Is(err, lsmtree.ErrKeyNotFound) {
+				return fmt.Errorf("%w: key does not exist", ErrPreconditionFailed)
+			}
+			return fmt.Errorf("[CompareAndSwap] fatal: %w", err)
+		}
+
+		if !bytes.Equal(current, expected) {
+			return fmt.Errorf("%w: value does not match", ErrPreconditionFailed)
+		}
+		return nil
+	})
+}
+
+// PutIfAbsent sets key to value if key does not exist, otherwise ErrPreconditionFailed is returned.
+//
+// The condition is evaluated by the commitlog writer, so it is linearizable with respect to all other writes.
+func (db *Database) PutIfAbsent(ctx context.Context, key, value []byte) error {
+
+	return db.writer.WriteBatchIf([]*pb.Mutation{putMutation(key, value)}, func() error {
+
+		_, err := db.lsmTree.Get(key)
+		if err == nil {
+			return fmt.Errorf("%w: key exists", ErrPreconditionFailed)
+		}
+
+		if !errors.Is(err, lsmtree.ErrKeyNotFound) {
+			return fmt.Errorf("[PutIfAbsent] fatal: %w", err)
+		}
+		return nil
+	})
+}
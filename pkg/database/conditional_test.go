@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalWrites(t *testing.T) {
+
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+
+	assert.ErrorIs(t, db.CompareAndSwap(ctx, []byte("a"), []byte("1"), []byte("2")), ErrPreconditionFailed)
+	assert.NoError(t, db.PutIfAbsent(ctx, []byte("a"), []byte("1")))
+	assert.ErrorIs(t, db.PutIfAbsent(ctx, []byte("a"), []byte("2")), ErrPreconditionFailed)
+
+	assert.ErrorIs(t, db.CompareAndSwap(ctx, []byte("a"), []byte("2"), []byte("3")), ErrPreconditionFailed)
+	assert.NoError(t, db.CompareAndSwap(ctx, []byte("a"), []byte("1"), []byte("2")))
+
+	val, err := db.Get(ctx, []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), val)
+
+	// only one of the concurrent writers succeeds
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results <- db.CompareAndSwap(ctx, []byte("a"), []byte("2"), []byte(fmt.Sprint(i)))
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
@@ -2,60 +2,67 @@ package database
 
 import (
 	"context"
-	"encoding/gob"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/crikke/oi/pkg/data/commitlog"
 	"github.com/crikke/oi/pkg/data/lsmtree"
 	"github.com/crikke/oi/pkg/data/lsmtree/memtree"
-	pb "github.com/crikke/oi/proto-gen/data"
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-const DescriptorPrefix = "db_"
-
-// Descriptor holds metadata about the database
-type Descriptor struct {
-	Name string
-	// UUID
-	UUID uuid.UUID
-	// The most recent synced (written to SSTable) record.
-	LastAppliedRecord uint64
-	Stopped           bool
-}
-
 type Configuration struct {
 	Directory struct {
 		Data string
 		Log  string
 	}
-	Commitlog struct {
-		SegmentSize uint32
-	}
-	Memtree memtree.Configuration
+	Commitlog  commitlog.Configuration
+	Memtree    memtree.Configuration
+	Compaction lsmtree.CompactionConfiguration
+	SSTable    lsmtree.SSTableConfiguration
+	Cache      lsmtree.CacheConfiguration
+	// NewArchiver returns the archiver of the database with the name, enabling archive mode.
+	// Defaults to a commitlog.LocalArchiver if Commitlog.ArchiveDir is set.
+	NewArchiver func(name string) (commitlog.Archiver, error)
 }
 
 type Database struct {
-	lsmTree        *lsmtree.LSMTree
-	configuration  Configuration
-	Descriptor     *Descriptor
-	writer         *commitlog.Writer
+	lsmTree       *lsmtree.LSMTree
+	configuration Configuration
+	Descriptor    *Descriptor
+	writer        *commitlog.Writer
+	// nil unless archive mode is enabled
+	archiver       commitlog.Archiver
 	cancelFunc     func()
 	descriptorPath string
+	// guards updates of the descriptor
+	mu sync.Mutex
+	// set once the database is closed, guarded by mu
+	closed bool
 }
 
-func CreateDatabase(descriptorDir, name string) (*Database, error) {
+// CreateDatabase writes the descriptor of a new database and opens it.
+//
+// The compaction strategy of the configuration is stored in the descriptor, so the database keeps its strategy when reopened.
+func CreateDatabase(descriptorDir, name string, c Configuration) (*Database, error) {
+
+	if _, err := lsmtree.NewCompactionStrategy(c.Compaction); err != nil {
+		return nil, err
+	}
+
 	d := Descriptor{
-		Name: name,
-		UUID: uuid.New(),
+		Name:               name,
+		UUID:               uuid.New(),
+		CompactionStrategy: c.Compaction.Strategy,
 	}
 
-	filename := fmt.Sprintf("%s%s", d.UUID.String(), DescriptorPrefix)
+	filename := fmt.Sprintf("%s%s", DescriptorPrefix, d.UUID.String())
 
 	if _, err := os.Stat(filepath.Join(descriptorDir, filename)); !errors.Is(err, os.ErrNotExist) {
 
@@ -66,42 +73,30 @@ func CreateDatabase(descriptorDir, name string) (*Database, error) {
 		return nil, errors.New("descriptor exists")
 	}
 
-	f, err := os.OpenFile(filepath.Join(descriptorDir, filename), os.O_CREATE|os.O_APPEND, 0660)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if err := encodeDescriptor(f, d); err != nil {
+	if err := writeDescriptor(filepath.Join(descriptorDir, filename), d); err != nil {
 		return nil, err
 	}
 
-	if err = f.Close(); err != nil {
-		return nil, err
-	}
-	return nil, nil
+	return OpenDatabase(filepath.Join(descriptorDir, filename), c)
 }
 
+// OpenDatabase reads the descriptor at descriptorPath. An error is returned if the descriptor is corrupt.
 func OpenDatabase(descriptorPath string, c Configuration) (*Database, error) {
 
-	f, err := os.Open(descriptorPath)
-
+	m, err := readDescriptor(descriptorPath)
 	if err != nil {
 		return nil, err
 	}
 
-	m, err := decodeDescriptor(f)
-	if err != nil {
-		return nil, err
+	if m.CompactionStrategy != "" {
+		c.Compaction.Strategy = m.CompactionStrategy
 	}
+
 	db := &Database{
 		Descriptor:     &m,
 		configuration:  c,
 		descriptorPath: descriptorPath,
 	}
-	if err = f.Close(); err != nil {
-		return nil, err
-	}
 	return db, nil
 }
 
@@ -112,63 +107,168 @@ func OpenDatabase(descriptorPath string, c Configuration) (*Database, error) {
 func (db *Database) Start() error {
 
 	ctx, cancel := context.WithCancel(context.Background())
-	ensureDirExists(fmt.Sprintf("%s/%s", db.configuration.Directory.Log, db.Descriptor.Name))
-	ensureDirExists(fmt.Sprintf("%s/%s", db.configuration.Directory.Data, db.Descriptor.Name))
+	ensureDirExists(db.logDir())
+	ensureDirExists(db.dataDir())
+
+	archiver, err := db.newArchiver()
+	if err != nil {
+		cancel()
+		return fmt.Errorf("[Init] Fatal: %w", err)
+	}
+	db.archiver = archiver
 
-	db.lsmTree = lsmtree.NewLSMTree(&lsmtree.Configuration{
-		DataDir:        db.configuration.Directory.Data,
+	lsmTree, err := lsmtree.NewLSMTree(&lsmtree.Configuration{
+		DataDir:        db.dataDir(),
 		MemtreeMaxSize: uint32(db.configuration.Memtree.MaxSize),
+		Compaction:     db.configuration.Compaction,
+		SSTable:        db.configuration.SSTable,
+		Cache:          db.configuration.Cache,
+		FlushCallback:  db.checkpoint,
+		Sequence:       db.Descriptor.LastAppliedRecord,
 	})
-
+	if err != nil {
+		cancel()
+		return fmt.Errorf("[Init] Fatal: %w", err)
+	}
+	db.lsmTree = lsmTree
 	db.cancelFunc = cancel
-	w, err := commitlog.NewWriter(ctx, db.configuration.Directory.Log, int(db.configuration.Commitlog.SegmentSize), db.lsmTree.Append)
+
+	// records are replayed before the writer is started, so new records are applied after the replayed records
+	if err := db.ensureRecordsAreApplied(ctx); err != nil {
+		cancel()
+		return fmt.Errorf("[Init] Fatal: %w", err)
+	}
+
+	// a restored database has no segments after the snapshot, new records must get a LSN after the applied records
+	if err := commitlog.CreateSegmentAfter(db.logDir(), db.Descriptor.LastAppliedRecord); err != nil {
+		cancel()
+		return fmt.Errorf("[Init] Fatal: %w", err)
+	}
+
+	// in archive mode the writer archives the segments once they are sealed
+	cfg := db.configuration.Commitlog
+	cfg.Archiver = db.archiver
+
+	w, err := commitlog.NewWriter(ctx, db.logDir(), cfg, db.lsmTree.AppendBatch)
 
 	if err != nil {
+		cancel()
 		return fmt.Errorf("[Init] Fatal: %w", err)
 	}
 	db.writer = w
 
-	db.ensureRecordsAreApplied(ctx)
 	return nil
 
 }
 
+// newArchiver returns the archiver of the database, or nil if archive mode is disabled
+func (db *Database) newArchiver() (commitlog.Archiver, error) {
+	return NewArchiver(db.Descriptor.Name, db.configuration)
+}
+
+// NewArchiver returns the archiver of the database with the name, or nil if archive mode is disabled in the configuration.
+// Used to restore a database from the archived records of another database.
+func NewArchiver(name string, c Configuration) (commitlog.Archiver, error) {
+
+	if c.NewArchiver != nil {
+		return c.NewArchiver(name)
+	}
+
+	if c.Commitlog.ArchiveDir != "" {
+		return commitlog.NewLocalArchiver(filepath.Join(c.Commitlog.ArchiveDir, name))
+	}
+	return nil, nil
+}
+
+// directory of the commitlog segments of the database
+func (db *Database) logDir() string {
+	return filepath.Join(db.configuration.Directory.Log, db.Descriptor.Name)
+}
+
+// directory of the SSTables of the database
+func (db *Database) dataDir() string {
+	return filepath.Join(db.configuration.Directory.Data, db.Descriptor.Name)
+}
+
+// ensureRecordsAreApplied replays the records which are not yet written to a SSTable into the memtree
 func (d *Database) ensureRecordsAreApplied(ctx context.Context) error {
 
-	if d.Descriptor.LastAppliedRecord > 0 {
-		segmentFiles, err := commitlog.GetTrailingSegments(d.configuration.Directory.Log, d.Descriptor.LastAppliedRecord)
+	segmentFiles, err := commitlog.GetTrailingSegments(d.logDir(), d.Descriptor.LastAppliedRecord)
 
-		if err != nil {
-			return fmt.Errorf("[ensureRecordsAreApplied] fatal: %w", err)
-		}
+	if err != nil {
+		return fmt.Errorf("[ensureRecordsAreApplied] fatal: %w", err)
+	}
 
-		for _, segment := range segmentFiles {
+	for i, segment := range segmentFiles {
 
-			select {
-			case <-ctx.Done():
-				log.Println("cancelled applying records")
-				return nil
-			default:
-				if err := replaySegment(ctx, segment, d, *d.Descriptor); err != nil {
-					return fmt.Errorf("[ensureRecordsAreApplied] fatal: %w", err)
-				}
+		select {
+		case <-ctx.Done():
+			log.Println("cancelled applying records")
+			return nil
+		default:
+			if err := replaySegment(ctx, segment, d, *d.Descriptor, i == len(segmentFiles)-1); err != nil {
+				return fmt.Errorf("[ensureRecordsAreApplied] fatal: %w", err)
 			}
 		}
 	}
 	return nil
 }
 
-// Close flushes the memtable to disk and is called when the server is shutting down.
+// checkpoint is called once the records up to lsn are written to SSTables.
+// The descriptor is updated before the segments are removed, so the records are not replayed
+// on the next start even if the server crashes in between.
+func (db *Database) checkpoint(lsn uint64) error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if lsn <= db.Descriptor.LastAppliedRecord {
+		return nil
+	}
+
+	db.Descriptor.LastAppliedRecord = lsn
+	if err := writeDescriptor(db.descriptorPath, *db.Descriptor); err != nil {
+		return fmt.Errorf("[checkpoint] fatal: %w", err)
+	}
+
+	if err := commitlog.RemoveAppliedSegments(db.logDir(), lsn, db.archiver); err != nil {
+		return fmt.Errorf("[checkpoint] fatal: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the memtable to disk and is called when the server is shutting down. Closing a closed database does nothing.
 func (d *Database) Close() error {
+
+	d.mu.Lock()
+	closed := d.closed
+	d.closed = true
+	d.mu.Unlock()
+
+	if closed {
+		return nil
+	}
+	// the writer archives the current segment when it shuts down. A failed writer has already failed the writes,
+	// so its error is only logged.
 	d.cancelFunc()
-	return nil
+	if err := d.writer.Wait(); err != nil {
+		log.Printf("commitlog writer of %s stopped: %v", d.Descriptor.Name, err)
+	}
+	return d.lsmTree.Close()
 }
 
 // Stop the database manually. When server restarts, the database wont be started automatically.
 func (d *Database) Stop() error {
 	// even if database fails to close, set stopped to true.
 	// this is done so next time the server is starting the database will be stopped.
+	d.mu.Lock()
 	d.Descriptor.Stopped = true
+	err := writeDescriptor(d.descriptorPath, *d.Descriptor)
+	d.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("[Stop] fatal: %w", err)
+	}
 
 	if err := d.Close(); err != nil {
 		// TODO: implement logger
@@ -178,74 +278,147 @@ func (d *Database) Stop() error {
 	return nil
 }
 
+// Put returns once the mutation is written to the commitlog and applied to the memtree.
 func (db *Database) Put(ctx context.Context, key, value []byte) error {
+	return db.writer.Write(putMutation(key, value))
+}
 
-	m := &pb.Mutation{
-		Key:       key,
-		Value:     value,
-		Tombstone: nil,
-	}
+// PutWithTTL writes the value which expires after ttl, once expired the key is no longer returned by reads.
+func (db *Database) PutWithTTL(ctx context.Context, key, value []byte, ttl time.Duration) error {
+
+	m := putMutation(key, value)
+	m.ExpireTime = timestamppb.New(time.Now().Add(ttl))
 	return db.writer.Write(m)
 }
 
+// Delete the key by writing a tombstone. The tombstone shadows older values of the key until
+// it is purged by compaction.
+func (db *Database) Delete(ctx context.Context, key []byte) error {
+	return db.writer.Write(deleteMutation(key))
+}
+
+// DeleteRange deletes every key within [start, end) by writing a single range tombstone.
+// Returns ErrInvalidRange if start is not before end.
+func (db *Database) DeleteRange(ctx context.Context, start, end []byte) error {
+
+	if err := validateRange(start, end); err != nil {
+		return err
+	}
+	return db.writer.Write(deleteRangeMutation(start, end))
+}
+
 func (db *Database) Get(ctx context.Context, key []byte) ([]byte, error) {
 
-	value, err := db.lsmTree.Get(key)
+	return db.lsmTree.Get(key)
+}
+
+// Scan returns an iterator over the keys within [start, end). If end is nil there is no upper bound.
+// The iterator must be closed.
+func (db *Database) Scan(ctx context.Context, start, end []byte) (lsmtree.Iterator, error) {
+	return db.lsmTree.Scan(start, end)
+}
 
-	return value, nil
+// ScanPrefix returns an iterator over the keys starting with prefix. The iterator must be closed.
+func (db *Database) ScanPrefix(ctx context.Context, prefix []byte) (lsmtree.Iterator, error) {
+	return db.lsmTree.ScanPrefix(prefix)
 }
 
-func replaySegment(ctx context.Context, s os.DirEntry, db *Database, descriptor Descriptor) error {
+// CacheStats returns the hits and misses of the SSTable caches
+func (db *Database) CacheStats() lsmtree.CacheStats {
+	return db.lsmTree.CacheStats()
+}
 
-	f, err := os.Open(s.Name())
-	if err != nil {
-		panic(err)
+// TableProperties returns the key range, sequence range and sizes of the SSTables of the database
+func (db *Database) TableProperties() ([]lsmtree.TableProperties, error) {
+	return db.lsmTree.TableProperties()
+}
+
+// Checkpoint creates a consistent snapshot of the database in dir, which must not exist.
+//
+// The memtree is flushed and the SSTables are hard linked into dir, so dir must be on the same filesystem as the data directory.
+// The descriptor is written to the snapshot with LastAppliedRecord set to the LSN of the checkpoint, which is returned.
+// The snapshot is restored with Restore.
+func (db *Database) Checkpoint(dir string) (uint64, error) {
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return 0, fmt.Errorf("[Checkpoint] fatal: %w", err)
 	}
-	defer f.Close()
 
-	records, err := commitlog.ReadLogSegment(ctx, f)
+	// read before the SSTables are linked, the linked SSTables contain at least every record up to it
+	db.mu.Lock()
+	applied := db.Descriptor.LastAppliedRecord
+	db.mu.Unlock()
+
+	lsn, err := db.lsmTree.Checkpoint(dir)
 	if err != nil {
-		return fmt.Errorf("[replaySegment] fatal: %w", err)
+		return 0, fmt.Errorf("[Checkpoint] fatal: %w", err)
 	}
 
-	for _, record := range records {
-
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+	if applied > lsn {
+		lsn = applied
+	}
 
-			// skip applied records
-			if record.LSN <= descriptor.LastAppliedRecord {
-				continue
-			}
-			m := &commitlog.Mutation{}
-			m.UnmarshalBinary(record.Data)
-			db.memtable.Put(m.Key, m.Value)
+	db.mu.Lock()
+	d := *db.Descriptor
+	db.mu.Unlock()
 
-		}
+	d.LastAppliedRecord = lsn
+	d.Stopped = false
+	if err := writeDescriptor(filepath.Join(dir, SnapshotDescriptor), d); err != nil {
+		return 0, fmt.Errorf("[Checkpoint] fatal: %w", err)
 	}
-	return nil
+
+	return lsn, nil
+}
+
+// Subscribe returns a subscription to the commitlog records of the database with a LSN greater than or equal to from.
+// A subscriber which disconnects resumes from the LSN following the last received record. The subscription must be closed.
+// In archive mode the records of removed segments are read from the archive.
+func (db *Database) Subscribe(from uint64) (*commitlog.Subscription, error) {
+	return db.writer.Subscribe(from, db.archiver)
 }
 
-func decodeDescriptor(r io.Reader) (Descriptor, error) {
+// replaySegment applies the records of the segment which are not yet applied.
+//
+// A corrupt record at the end of the last segment was being written when the server crashed and was never acknowledged,
+// so the records before it are replayed. Any other corruption is returned as an error.
+func replaySegment(ctx context.Context, s os.DirEntry, db *Database, descriptor Descriptor, last bool) error {
 
-	m := Descriptor{}
-	dec := gob.NewDecoder(r)
+	f, err := os.Open(filepath.Join(db.logDir(), s.Name()))
+	if err != nil {
+		return fmt.Errorf("[replaySegment] fatal: %w", err)
+	}
+	defer f.Close()
 
-	if err := dec.Decode(&m); err != nil {
-		return Descriptor{}, err
+	// skip applied records
+	start := uint64(0)
+	if descriptor.LastAppliedRecord > 0 {
+		start = descriptor.LastAppliedRecord + 1
 	}
 
-	return m, nil
-}
+	reader := commitlog.NewSegmentReader(f, start)
+	for reader.Next() {
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
 
-func encodeDescriptor(w io.Writer, d Descriptor) error {
+		record := reader.Record()
 
-	enc := gob.NewEncoder(w)
+		// the mutations of a batch are applied together
+		if err := db.lsmTree.AppendBatch(record.LSN, commitlog.Mutations(record)); err != nil {
+			return fmt.Errorf("[replaySegment] fatal: %w", err)
+		}
+	}
 
-	if err := enc.Encode(d); err != nil {
-		return err
+	if err := reader.Err(); err != nil {
+		corruption := &commitlog.CorruptionError{}
+		if !last || !errors.As(err, &corruption) || !corruption.Tail {
+			return fmt.Errorf("[replaySegment] fatal: %w", err)
+		}
+		log.Printf("ignoring torn record at the end of the commitlog: %v", err)
 	}
 	return nil
 }
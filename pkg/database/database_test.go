@@ -0,0 +1,64 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestDatabase creates and starts a database in a temporary directory, the database is stopped once the test ends.
+// configure modifies the configuration of the database before it is created.
+func newTestDatabase(t *testing.T, configure ...func(c *Configuration)) *Database {
+
+	dir := t.TempDir()
+
+	c := Configuration{}
+	c.Directory.Data = filepath.Join(dir, "data")
+	c.Directory.Log = filepath.Join(dir, "log")
+	c.Memtree.MaxSize = 1 << 20
+	for _, f := range configure {
+		f(&c)
+	}
+
+	descriptors := filepath.Join(dir, "descriptors")
+	if !assert.NoError(t, os.MkdirAll(descriptors, 0755)) {
+		t.FailNow()
+	}
+
+	db, err := CreateDatabase(descriptors, "db", c)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, db.Start()) {
+		t.FailNow()
+	}
+
+	t.Cleanup(func() {
+		assert.NoError(t, db.Stop())
+	})
+	return db
+}
+
+// reopenTestDatabase closes the database and opens it again from its descriptor, like a restart of the server.
+// The reopened database is stopped once the test ends.
+func reopenTestDatabase(t *testing.T, db *Database) *Database {
+
+	if !assert.NoError(t, db.Close()) {
+		t.FailNow()
+	}
+
+	reopened, err := OpenDatabase(db.descriptorPath, db.configuration)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, reopened.Start()) {
+		t.FailNow()
+	}
+
+	t.Cleanup(func() {
+		assert.NoError(t, reopened.Stop())
+	})
+	return reopened
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DescriptorPrefix = "db_"
+	// descriptors are written to a temporary file before replacing the descriptor
+	descriptorTmpPrefix = "tmp_"
+
+	// descriptorMagic identifies a versioned descriptor file.
+	// Descriptors written before the format was versioned are plain gob and are read as version 0.
+	descriptorMagic   = "OIDB"
+	descriptorVersion = uint16(1)
+	// magic, version, payload length and checksum
+	descriptorHeaderSize = 4 + 2 + 4 + 4
+)
+
+var ErrDescriptorCorrupt = errors.New("descriptor is corrupt")
+
+// Descriptor holds metadata about the database
+type Descriptor struct {
+	Name string
+	// UUID
+	UUID uuid.UUID
+	// The most recent synced (written to SSTable) record.
+	LastAppliedRecord uint64
+	Stopped           bool
+	// The compaction strategy selected when the database was created
+	CompactionStrategy string
+}
+
+// writeDescriptor replaces the descriptor at path.
+//
+// The descriptor is written to a temporary file which is fsynced and renamed over the old descriptor,
+// so a crash leaves either the old or the new descriptor, never a partially written one.
+func writeDescriptor(path string, d Descriptor) error {
+
+	tmp := filepath.Join(filepath.Dir(path), descriptorTmpPrefix+filepath.Base(path))
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+	if err != nil {
+		return fmt.Errorf("[writeDescriptor] fatal: %w", err)
+	}
+
+	if err := encodeDescriptor(f, d); err != nil {
+		f.Close()
+		return fmt.Errorf("[writeDescriptor] fatal: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("[writeDescriptor] fatal: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("[writeDescriptor] fatal: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[writeDescriptor] fatal: %w", err)
+	}
+
+	// fsync the directory so the rename is durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("[writeDescriptor] fatal: %w", err)
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// readDescriptor reads and validates the descriptor at path
+func readDescriptor(path string) (Descriptor, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer f.Close()
+
+	d, err := decodeDescriptor(f)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("[readDescriptor] %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// decodeDescriptor reads a descriptor and verifies its checksum.
+func decodeDescriptor(r io.Reader) (Descriptor, error) {
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(descriptorMagic)) {
+		// version 0
+		return decodeDescriptorPayload(data)
+	}
+
+	if len(data) < descriptorHeaderSize {
+		return Descriptor{}, fmt.Errorf("%w: truncated header", ErrDescriptorCorrupt)
+	}
+
+	version := binary.LittleEndian.Uint16(data[4:6])
+	length := binary.LittleEndian.Uint32(data[6:10])
+	checksum := binary.LittleEndian.Uint32(data[10:14])
+
+	if version != descriptorVersion {
+		return Descriptor{}, fmt.Errorf("unsupported descriptor version %d", version)
+	}
+
+	payload := data[descriptorHeaderSize:]
+	if uint32(len(payload)) != length {
+		return Descriptor{}, fmt.Errorf("%w: expected %d bytes, got %d", ErrDescriptorCorrupt, length, len(payload))
+	}
+
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return Descriptor{}, fmt.Errorf("%w: checksum mismatch", ErrDescriptorCorrupt)
+	}
+
+	return decodeDescriptorPayload(payload)
+}
+
+func decodeDescriptorPayload(data []byte) (Descriptor, error) {
+
+	m := Descriptor{}
+	dec := gob.NewDecoder(bytes.NewReader(data))
+
+	if err := dec.Decode(&m); err != nil {
+		return Descriptor{}, err
+	}
+
+	return m, nil
+}
+
+// encodeDescriptor writes the descriptor as
+//
+//	magic | version uint16 | payload length uint32 | crc32 of payload uint32 | gob payload
+func encodeDescriptor(w io.Writer, d Descriptor) error {
+
+	payload := bytes.Buffer{}
+	enc := gob.NewEncoder(&payload)
+
+	if err := enc.Encode(d); err != nil {
+		return err
+	}
+
+	header := make([]byte, descriptorHeaderSize)
+	copy(header, descriptorMagic)
+	binary.LittleEndian.PutUint16(header[4:6], descriptorVersion)
+	binary.LittleEndian.PutUint32(header[6:10], uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(header[10:14], crc32.ChecksumIEEE(payload.Bytes()))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload.Bytes())
+	return err
+}
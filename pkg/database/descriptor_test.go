@@ -0,0 +1,59 @@
+package database
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescriptor(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DescriptorPrefix+"test")
+	d := Descriptor{Name: "test", UUID: uuid.New(), LastAppliedRecord: 1 << 32}
+
+	assert.NoError(t, writeDescriptor(path, d))
+
+	d.Stopped = true
+	assert.NoError(t, writeDescriptor(path, d))
+
+	actual, err := readDescriptor(path)
+	assert.NoError(t, err)
+	assert.Equal(t, d, actual)
+
+	// flip a byte of the payload
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0660))
+
+	_, err = readDescriptor(path)
+	assert.ErrorIs(t, err, ErrDescriptorCorrupt)
+}
+
+func TestReadUnversionedDescriptor(t *testing.T) {
+
+	dir := fmt.Sprintf("/tmp/%s", uuid.NewString())
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, DescriptorPrefix+"test")
+	d := Descriptor{Name: "test", UUID: uuid.New()}
+
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, gob.NewEncoder(f).Encode(d))
+	assert.NoError(t, f.Close())
+
+	actual, err := readDescriptor(path)
+	assert.NoError(t, err)
+	assert.Equal(t, d, actual)
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	protoutil "github.com/crikke/oi/pkg/data"
+	"github.com/crikke/oi/pkg/data/commitlog"
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+// SnapshotDescriptor is the name of the descriptor within a snapshot directory.
+//
+// A snapshot directory is created by Database.Checkpoint and contains the descriptor and the SSTable directories of a database. LastAppliedRecord of the
+// descriptor is the LSN of the most recent record in the SSTables.
+const SnapshotDescriptor = "DESCRIPTOR"
+
+// RestoreTarget selects the last archived record replayed when restoring a database.
+// If both LSN and Time are unset every archived record is replayed.
+type RestoreTarget struct {
+	// records with a greater LSN are not replayed
+	LSN uint64
+	// records written after Time are not replayed
+	Time time.Time
+}
+
+func (t RestoreTarget) includes(r *pb.Record) bool {
+
+	if t.LSN > 0 && r.LSN > t.LSN {
+		return false
+	}
+
+	if !t.Time.IsZero() && r.Timestamp != nil && r.Timestamp.AsTime().After(t.Time) {
+		return false
+	}
+	return true
+}
+
+// Restore creates a new database with the name from the snapshot, and replays the archived records
+// following the snapshot up to the target. archiver may be nil to restore only the snapshot.
+//
+// The descriptor is written last, so a failed restore does not leave a database which is loaded on the next start.
+func Restore(ctx context.Context, descriptorDir, name, snapshotDir string, archiver commitlog.Archiver, target RestoreTarget, c Configuration) (*Database, error) {
+
+	snapshot, err := readDescriptor(filepath.Join(snapshotDir, SnapshotDescriptor))
+	if err != nil {
+		return nil, fmt.Errorf("[Restore] fatal: %w", err)
+	}
+
+	d := Descriptor{
+		Name:               name,
+		UUID:               uuid.New(),
+		LastAppliedRecord:  snapshot.LastAppliedRecord,
+		CompactionStrategy: snapshot.CompactionStrategy,
+	}
+
+	dataDir := filepath.Join(c.Directory.Data, name)
+	logDir := filepath.Join(c.Directory.Log, name)
+
+	for _, dir := range []string{dataDir, logDir} {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return nil, fmt.Errorf("[Restore] directory %s is not empty", dir)
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("[Restore] fatal: %w", err)
+		}
+	}
+
+	if err := copySSTables(snapshotDir, dataDir); err != nil {
+		return nil, fmt.Errorf("[Restore] fatal: %w", err)
+	}
+
+	if archiver != nil {
+		if err := restoreSegments(ctx, archiver, logDir, d.LastAppliedRecord, target); err != nil {
+			return nil, fmt.Errorf("[Restore] fatal: %w", err)
+		}
+	}
+
+	path := filepath.Join(descriptorDir, fmt.Sprintf("%s%s", DescriptorPrefix, d.UUID.String()))
+	if err := writeDescriptor(path, d); err != nil {
+		return nil, fmt.Errorf("[Restore] fatal: %w", err)
+	}
+
+	return OpenDatabase(path, c)
+}
+
+// copySSTables copies the manifest and the SSTable directories of the snapshot to the data directory
+func copySSTables(snapshotDir, dataDir string) error {
+
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == lsmtree.ManifestName {
+			if err := copyFile(filepath.Join(snapshotDir, entry.Name()), filepath.Join(dataDir, entry.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), lsmtree.SSTablePrefix) {
+			continue
+		}
+
+		dst := filepath.Join(dataDir, entry.Name())
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+
+		files, err := os.ReadDir(filepath.Join(snapshotDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if err := copyFile(filepath.Join(snapshotDir, entry.Name(), f.Name()), filepath.Join(dst, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// restoreSegments writes the archived records up to the target into the log directory, keeping their segments and LSNs.
+// The records are replayed when the database is started.
+func restoreSegments(ctx context.Context, archiver commitlog.Archiver, logDir string, lastApplied uint64, target RestoreTarget) error {
+
+	segments, err := archiver.Segments()
+	if err != nil {
+		return err
+	}
+
+	for i, name := range segments {
+
+		if n, err := commitlog.ParseSegmentName(name); err != nil || n < uint64(commitlog.SegmentNumber(lastApplied)) {
+			continue
+		}
+
+		done, err := restoreSegment(ctx, archiver, name, logDir, target, i == len(segments)-1)
+		if err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+	}
+	return nil
+}
+
+// restoreSegment copies the records of the archived segment which are included in the target.
+// Returns true once a record past the target is found. Only the last archived segment may end with a torn record.
+func restoreSegment(ctx context.Context, archiver commitlog.Archiver, name, logDir string, target RestoreTarget, last bool) (bool, error) {
+
+	r, err := archiver.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	out, err := os.OpenFile(filepath.Join(logDir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	done := false
+	reader := commitlog.NewSegmentReader(r, 0)
+	for reader.Next() {
+
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		record := reader.Record()
+		if !target.includes(record) {
+			done = true
+			break
+		}
+
+		data, err := proto.Marshal(record)
+		if err != nil {
+			return false, err
+		}
+
+		entry, _ := protoutil.ProtoEntry{Data: data, DataLen: uint32(len(data))}.MarshalBinary()
+		if _, err := out.Write(entry); err != nil {
+			return false, err
+		}
+	}
+
+	if err := reader.Err(); err != nil {
+		corruption := &commitlog.CorruptionError{}
+		if !errors.As(err, &corruption) || !corruption.Tail || !last {
+			return false, err
+		}
+	}
+
+	return done, out.Sync()
+}
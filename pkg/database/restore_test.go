@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreToLSN(t *testing.T) {
+
+	dir := t.TempDir()
+	db := newTestDatabase(t, func(c *Configuration) {
+		c.Commitlog.SegmentSize = 256
+		c.Commitlog.ArchiveDir = filepath.Join(dir, "archive")
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, db.Put(ctx, []byte(fmt.Sprintf("key%02d", i)), []byte("value")))
+	}
+
+	// the LSN of the record of key19
+	sub, err := db.Subscribe(0)
+	assert.NoError(t, err)
+	target := uint64(0)
+	for i := 0; i < 20; i++ {
+		r, err := sub.Next(ctx)
+		assert.NoError(t, err)
+		target = r.LSN
+	}
+	sub.Close()
+
+	// the segments are archived once they are sealed, nothing has been flushed
+	archiver, err := NewArchiver("db", db.configuration)
+	assert.NoError(t, err)
+	archived, err := archiver.Segments()
+	assert.NoError(t, err)
+	assert.Greater(t, len(archived), 1)
+
+	// an empty snapshot, every archived record is replayed
+	snapshot := filepath.Join(dir, "snapshot")
+	assert.NoError(t, os.MkdirAll(snapshot, 0755))
+	assert.NoError(t, writeDescriptor(filepath.Join(snapshot, SnapshotDescriptor), Descriptor{Name: "db"}))
+
+	restored, err := Restore(ctx, filepath.Dir(db.descriptorPath), "restored", snapshot, archiver, RestoreTarget{LSN: target}, db.configuration)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Start())
+	defer restored.Close()
+
+	val, err := restored.Get(ctx, []byte("key19"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), val)
+
+	_, err = restored.Get(ctx, []byte("key20"))
+	assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+
+	// the current segment is archived when the database is closed
+	assert.NoError(t, db.Close())
+
+	latest, err := Restore(ctx, filepath.Dir(db.descriptorPath), "latest", snapshot, archiver, RestoreTarget{}, db.configuration)
+	assert.NoError(t, err)
+	assert.NoError(t, latest.Start())
+	defer latest.Close()
+
+	val, err = latest.Get(ctx, []byte("key49"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), val)
+}
+
+func TestCheckpoint(t *testing.T) {
+
+	db := newTestDatabase(t, func(c *Configuration) {
+		c.Commitlog.SegmentSize = 1 << 20
+	})
+	dir := t.TempDir()
+
+	ctx := context.Background()
+	assert.NoError(t, db.Put(ctx, []byte("a"), []byte("1")))
+	assert.NoError(t, db.Put(ctx, []byte("b"), []byte("1")))
+
+	lsn, err := db.Checkpoint(filepath.Join(dir, "checkpoint"))
+	assert.NoError(t, err)
+	assert.Greater(t, lsn, uint64(0))
+
+	assert.NoError(t, db.Put(ctx, []byte("c"), []byte("1")))
+
+	restored, err := Restore(ctx, filepath.Dir(db.descriptorPath), "restored", filepath.Join(dir, "checkpoint"), nil, RestoreTarget{}, db.configuration)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Start())
+
+	assert.Equal(t, lsn, restored.Descriptor.LastAppliedRecord)
+
+	val, err := restored.Get(ctx, []byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	_, err = restored.Get(ctx, []byte("c"))
+	assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+
+	// the records written after the restore get a LSN after the snapshot, so they are replayed after a restart
+	assert.NoError(t, restored.Put(ctx, []byte("a"), []byte("2")))
+	assert.NoError(t, restored.Put(ctx, []byte("z"), []byte("2")))
+
+	restored = reopenTestDatabase(t, restored)
+	for _, key := range []string{"a", "z"} {
+		val, err := restored.Get(ctx, []byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("2"), val)
+	}
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+
+	"github.com/crikke/oi/pkg/data/lsmtree"
+)
+
+// Snapshot is a stable view of the database, writes acknowledged after the snapshot was created are not visible.
+// The snapshot must be released, until then compactions keep the versions visible to it.
+type Snapshot struct {
+	snapshot *lsmtree.Snapshot
+}
+
+// NewSnapshot returns a snapshot of every write acknowledged so far
+func (db *Database) NewSnapshot() *Snapshot {
+	return &Snapshot{snapshot: db.lsmTree.NewSnapshot()}
+}
+
+// LSN returns the LSN of the most recent record visible to the snapshot
+func (s *Snapshot) LSN() uint64 {
+	return s.snapshot.Sequence()
+}
+
+func (s *Snapshot) Get(ctx context.Context, key []byte) ([]byte, error) {
+	return s.snapshot.Get(key)
+}
+
+// Scan returns an iterator over the keys within [start, end) as seen by the snapshot. If end is nil there is no upper bound.
+// The iterator must be closed.
+func (s *Snapshot) Scan(ctx context.Context, start, end []byte) (lsmtree.Iterator, error) {
+	return s.snapshot.Scan(start, end)
+}
+
+func (s *Snapshot) Release() {
+	s.snapshot.Release()
+}
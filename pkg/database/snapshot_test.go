@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	assert.NoError(t, db.Put(ctx, []byte("a"), []byte("1")))
+	assert.NoError(t, db.Put(ctx, []byte("b"), []byte("1")))
+
+	snapshot := db.NewSnapshot()
+	defer snapshot.Release()
+
+	assert.NoError(t, db.Put(ctx, []byte("a"), []byte("2")))
+	assert.NoError(t, db.Delete(ctx, []byte("b")))
+	assert.NoError(t, db.Put(ctx, []byte("c"), []byte("2")))
+
+	val, err := db.Get(ctx, []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), val)
+
+	val, err = snapshot.Get(ctx, []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	val, err = snapshot.Get(ctx, []byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	_, err = snapshot.Get(ctx, []byte("c"))
+	assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+
+	it, err := snapshot.Scan(ctx, nil, nil)
+	assert.NoError(t, err)
+	defer it.Close()
+
+	keys := make([]string, 0)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.Equal(t, []string{"a", "b"}, keys)
+}
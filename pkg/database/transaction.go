@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	pb "github.com/crikke/oi/proto-gen/data"
+)
+
+var (
+	// ErrConflict is returned by Commit when a key read by the transaction was modified after the transaction began
+	ErrConflict = errors.New("transaction conflict")
+	// ErrTxDone is returned when using a transaction which is already committed or rolled back
+	ErrTxDone = errors.New("transaction already committed or rolled back")
+)
+
+// Transaction is an optimistic transaction. Reads see the snapshot of the database at the time the transaction began,
+// and the writes of the transaction itself. Writes are buffered until Commit.
+//
+// Commit fails with ErrConflict if any key read by the transaction was modified since the transaction began,
+// in which case the transaction should be retried.
+// A transaction must be committed or rolled back, until then compactions keep the versions visible to its snapshot.
+type Transaction struct {
+	db       *Database
+	snapshot *lsmtree.Snapshot
+	reads    map[string]struct{}
+	// the mutations in the order they were written
+	writes []*pb.Mutation
+	// the most recent write of each key
+	pending map[string]*pb.Mutation
+	done    bool
+}
+
+// BeginTx starts a transaction on the snapshot of every write acknowledged so far
+func (db *Database) BeginTx() *Transaction {
+	return &Transaction{
+		db:       db,
+		snapshot: db.lsmTree.NewSnapshot(),
+		reads:    make(map[string]struct{}),
+		pending:  make(map[string]*pb.Mutation),
+	}
+}
+
+// Get returns the value of key written by the transaction, or else the value of the snapshot.
+// The key is added to the read set of the transaction.
+func (tx *Transaction) Get(ctx context.Context, key []byte) ([]byte, error) {
+
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	if m, ok := tx.pending[string(key)]; ok {
+		if m.Tombstone != nil {
+			return nil, lsmtree.ErrKeyNotFound
+		}
+		return m.Value, nil
+	}
+
+	tx.reads[string(key)] = struct{}{}
+	return tx.snapshot.Get(key)
+}
+
+func (tx *Transaction) Put(key, value []byte) error {
+	return tx.write(putMutation(key, value))
+}
+
+func (tx *Transaction) Delete(key []byte) error {
+	return tx.write(deleteMutation(key))
+}
+
+func (tx *Transaction) write(m *pb.Mutation) error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.writes = append(tx.writes, m)
+	tx.pending[string(m.Key)] = m
+	return nil
+}
+
+// Commit writes the writes of the transaction as a single record, if none of the keys read by the transaction has been modified
+// since the transaction began. Otherwise ErrConflict is returned and nothing is written.
+// The transaction is done after Commit, also if it fails.
+func (tx *Transaction) Commit(ctx context.Context) error {
+
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.Rollback()
+
+	// the reads of a read-only transaction are all from the same snapshot
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	return tx.db.writer.WriteBatchIf(tx.writes, tx.validate)
+}
+
+// validate returns ErrConflict if a key of the read set has been modified after the snapshot of the transaction.
+// It is called by the commitlog writer while no other record is written.
+func (tx *Transaction) validate() error {
+
+	for key := range tx.reads {
+		seq, err := tx.db.lsmTree.LastModified([]byte(key))
+		if err != nil {
+			return fmt.Errorf("[Commit] fatal: %w", err)
+		}
+
+		if seq > tx.snapshot.Sequence() {
+			return fmt.Errorf("%w: key %q was modified", ErrConflict, key)
+		}
+	}
+	return nil
+}
+
+// Rollback discards the writes of the transaction. Rollback is a no-op if the transaction is already done.
+func (tx *Transaction) Rollback() {
+
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.snapshot.Release()
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction(t *testing.T) {
+
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+
+	t.Run("conflict", func(t *testing.T) {
+
+		assert.NoError(t, db.Put(ctx, []byte("a"), []byte("1")))
+
+		tx := db.BeginTx()
+		val, err := tx.Get(ctx, []byte("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("1"), val)
+		assert.NoError(t, tx.Put([]byte("b"), []byte("1")))
+
+		// the transaction sees its own writes
+		val, err = tx.Get(ctx, []byte("b"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("1"), val)
+
+		assert.NoError(t, db.Put(ctx, []byte("a"), []byte("2")))
+		assert.ErrorIs(t, tx.Commit(ctx), ErrConflict)
+		assert.ErrorIs(t, tx.Commit(ctx), ErrTxDone)
+
+		_, err = db.Get(ctx, []byte("b"))
+		assert.ErrorIs(t, err, lsmtree.ErrKeyNotFound)
+	})
+
+	t.Run("counter", func(t *testing.T) {
+
+		increment := func() error {
+			for {
+				tx := db.BeginTx()
+
+				n := 0
+				val, err := tx.Get(ctx, []byte("counter"))
+				if err == nil {
+					n, _ = strconv.Atoi(string(val))
+				} else if !errors.Is(err, lsmtree.ErrKeyNotFound) {
+					return err
+				}
+
+				tx.Put([]byte("counter"), []byte(strconv.Itoa(n+1)))
+				err = tx.Commit(ctx)
+				if !errors.Is(err, ErrConflict) {
+					return err
+				}
+			}
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					assert.NoError(t, increment())
+				}
+			}()
+		}
+		wg.Wait()
+
+		val, err := db.Get(ctx, []byte("counter"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("100"), val)
+	})
+}
@@ -1,14 +1,20 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/crikke/oi/pkg/data/commitlog"
+	"github.com/crikke/oi/pkg/data/lsmtree"
+	"github.com/crikke/oi/pkg/database"
 	"github.com/crikke/oi/pkg/server/proto"
-	"google.golang.org/grpc"
+	pb "github.com/crikke/oi/proto-gen/data"
 )
 
-func (s *Server) Put(ctx context.Context, in *proto.PutRequest, opts ...grpc.CallOption) (*proto.ResponseStatus, error) {
+func (s *Server) Put(ctx context.Context, in *proto.PutRequest) (*proto.ResponseStatus, error) {
 
 	db, ok := s.databases[in.GetDatabase()]
 
@@ -16,15 +22,286 @@ func (s *Server) Put(ctx context.Context, in *proto.PutRequest, opts ...grpc.Cal
 		return nil, errors.New("database not found")
 	}
 
-	err := db.Put(ctx, []byte(in.GetKey()), in.GetValue())
+	if in.GetTransaction() != "" {
+		if in.GetTtlSeconds() > 0 {
+			return nil, errors.New("ttl is not supported within a transaction")
+		}
+
+		tx, err := s.transactions.get(in.GetDatabase(), in.GetTransaction())
+		if err != nil {
+			return nil, err
+		}
+
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+
+		if err := tx.tx.Put([]byte(in.GetKey()), in.GetValue()); err != nil {
+			return nil, err
+		}
+		return &proto.ResponseStatus{}, nil
+	}
+
+	var err error
+	if in.GetTtlSeconds() > 0 {
+		err = db.PutWithTTL(ctx, []byte(in.GetKey()), in.GetValue(), time.Duration(in.GetTtlSeconds())*time.Second)
+	} else {
+		err = db.Put(ctx, []byte(in.GetKey()), in.GetValue())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.ResponseStatus{}, nil
+}
+
+func (s *Server) Get(ctx context.Context, in *proto.GetRequest) (*proto.GetResponse, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	get := db.Get
+	if in.GetTransaction() != "" {
+		tx, err := s.transactions.get(in.GetDatabase(), in.GetTransaction())
+		if err != nil {
+			return nil, err
+		}
+
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+		get = tx.tx.Get
+	}
+
+	value, err := get(ctx, []byte(in.GetKey()))
 
 	if err != nil {
 		return nil, err
 	}
 
+	return &proto.GetResponse{
+		Status: &proto.ResponseStatus{},
+		Value:  value,
+	}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, in *proto.DeleteRequest) (*proto.ResponseStatus, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	if in.GetTransaction() != "" {
+		tx, err := s.transactions.get(in.GetDatabase(), in.GetTransaction())
+		if err != nil {
+			return nil, err
+		}
+
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+
+		if err := tx.tx.Delete([]byte(in.GetKey())); err != nil {
+			return nil, err
+		}
+		return &proto.ResponseStatus{}, nil
+	}
+
+	if err := db.Delete(ctx, []byte(in.GetKey())); err != nil {
+		return nil, err
+	}
+
+	return &proto.ResponseStatus{}, nil
+}
+
+func (s *Server) DeleteRange(ctx context.Context, in *proto.DeleteRangeRequest) (*proto.ResponseStatus, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	if err := db.DeleteRange(ctx, []byte(in.GetStart()), []byte(in.GetEnd())); err != nil {
+		return nil, err
+	}
+
 	return &proto.ResponseStatus{}, nil
 }
 
-func (s *Server) Get(ctx context.Context, in *proto.GetRequest, opts ...grpc.CallOption) (*proto.GetResponse, error) {
-	panic("not implemented") // TODO: Implement
+func (s *Server) Batch(ctx context.Context, in *proto.BatchRequest) (*proto.ResponseStatus, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	batch := &database.WriteBatch{}
+
+	for _, op := range in.GetOperations() {
+		switch op.GetType() {
+		case proto.BatchOperation_PUT:
+			batch.Put([]byte(op.GetKey()), op.GetValue())
+		case proto.BatchOperation_DELETE:
+			batch.Delete([]byte(op.GetKey()))
+		case proto.BatchOperation_DELETE_RANGE:
+			batch.DeleteRange([]byte(op.GetKey()), []byte(op.GetEnd()))
+		default:
+			return nil, fmt.Errorf("unknown batch operation %v", op.GetType())
+		}
+	}
+
+	if err := db.Write(ctx, batch); err != nil {
+		return nil, err
+	}
+
+	return &proto.ResponseStatus{}, nil
+}
+
+func (s *Server) CompareAndSwap(ctx context.Context, in *proto.CompareAndSwapRequest) (*proto.ResponseStatus, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	return conditionalStatus(db.CompareAndSwap(ctx, []byte(in.GetKey()), in.GetExpectedValue(), in.GetValue()))
+}
+
+func (s *Server) PutIfAbsent(ctx context.Context, in *proto.PutIfAbsentRequest) (*proto.ResponseStatus, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	return conditionalStatus(db.PutIfAbsent(ctx, []byte(in.GetKey()), in.GetValue()))
+}
+
+// conditionalStatus returns the status of a conditional write, a failed precondition is not an error of the request
+func conditionalStatus(err error) (*proto.ResponseStatus, error) {
+
+	if err != nil {
+		if errors.Is(err, database.ErrPreconditionFailed) {
+			return &proto.ResponseStatus{Code: int32(proto.StatusCode_PRECONDITION_FAILED), ResponseMessage: err.Error()}, nil
+		}
+		return nil, err
+	}
+
+	return &proto.ResponseStatus{}, nil
+}
+
+func (s *Server) Scan(in *proto.ScanRequest, stream proto.Database_ScanServer) error {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return errors.New("database not found")
+	}
+
+	var it lsmtree.Iterator
+	var err error
+	if in.GetPrefix() != "" {
+		it, err = db.ScanPrefix(stream.Context(), []byte(in.GetPrefix()))
+	} else {
+		var end []byte
+		if in.GetEnd() != "" {
+			end = []byte(in.GetEnd())
+		}
+		it, err = db.Scan(stream.Context(), []byte(in.GetStart()), end)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for ; it.Valid(); it.Next() {
+		if err := stream.Send(&proto.ScanResponse{Key: string(it.Key()), Value: it.Value()}); err != nil {
+			return err
+		}
+	}
+
+	return it.Err()
+}
+
+func (s *Server) Watch(in *proto.WatchRequest, stream proto.Database_WatchServer) error {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return errors.New("database not found")
+	}
+
+	sub, err := db.Subscribe(in.GetFromLsn())
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	prefix := []byte(in.GetPrefix())
+	for {
+		record, err := sub.Next(stream.Context())
+		if err != nil {
+			return err
+		}
+
+		ops := make([]*proto.BatchOperation, 0)
+		for _, m := range commitlog.Mutations(record) {
+			if !matchesPrefix(m, prefix) {
+				continue
+			}
+			ops = append(ops, batchOperation(m))
+		}
+
+		if len(ops) == 0 {
+			continue
+		}
+
+		if err := stream.Send(&proto.WatchResponse{Lsn: record.LSN, Operations: ops}); err != nil {
+			return err
+		}
+	}
+}
+
+func batchOperation(m *pb.Mutation) *proto.BatchOperation {
+
+	switch {
+	case m.RangeTombstone != nil:
+		return &proto.BatchOperation{
+			Type: proto.BatchOperation_DELETE_RANGE,
+			Key:  string(m.RangeTombstone.Start),
+			End:  string(m.RangeTombstone.End),
+		}
+	case m.Tombstone != nil:
+		return &proto.BatchOperation{Type: proto.BatchOperation_DELETE, Key: string(m.Key)}
+	default:
+		return &proto.BatchOperation{Type: proto.BatchOperation_PUT, Key: string(m.Key), Value: m.Value}
+	}
+}
+
+// matchesPrefix reports if the mutation affects a key with the prefix.
+// A range deletion matches if the range overlaps the keys with the prefix.
+func matchesPrefix(m *pb.Mutation, prefix []byte) bool {
+
+	if len(prefix) == 0 {
+		return true
+	}
+
+	if m.RangeTombstone == nil {
+		return bytes.HasPrefix(m.Key, prefix)
+	}
+
+	start, end := m.RangeTombstone.Start, m.RangeTombstone.End
+	if bytes.HasPrefix(start, prefix) {
+		return true
+	}
+	// the range starts before the prefix, and must end after it
+	return bytes.Compare(start, prefix) < 0 && bytes.Compare(end, prefix) > 0
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/crikke/oi/pkg/data/commitlog"
 	"github.com/crikke/oi/pkg/database"
 	"github.com/crikke/oi/pkg/server/proto"
 	"go.uber.org/zap/zapcore"
@@ -19,7 +21,12 @@ func (s *Server) CreateDatabase(ctx context.Context, in *proto.CreateDatabaseReq
 		return nil, fmt.Errorf("database with name '%s' already exist", in.GetName())
 	}
 
-	db, err := database.CreateDatabase(s.Configuration.Directory.Metadata, in.GetName())
+	cfg := s.Configuration.Database
+	if in.GetCompactionStrategy() != "" {
+		cfg.Compaction.Strategy = in.GetCompactionStrategy()
+	}
+
+	db, err := database.CreateDatabase(s.Configuration.Directory.Metadata, in.GetName(), cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -65,3 +72,71 @@ func (s *Server) StopDatabase(ctx context.Context, in *proto.StopDatabaseRequest
 func (s *Server) StartDatabase(ctx context.Context, in *proto.StartDatabaseRequest) (*proto.StartDatabaseResponse, error) {
 	panic("not implemented") // TODO: Implement
 }
+
+func (s *Server) Backup(ctx context.Context, in *proto.BackupRequest) (*proto.BackupResponse, error) {
+
+	db, ok := s.databases[in.GetName()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	s.logger.Log(zapcore.InfoLevel, fmt.Sprintf("creating checkpoint of database '%s' in '%s'", in.GetName(), in.GetPath()))
+	lsn, err := db.Checkpoint(in.GetPath())
+	if err != nil {
+		return nil, fmt.Errorf("[Backup] error creating checkpoint: %w", err)
+	}
+
+	return &proto.BackupResponse{
+		Code: &proto.ResponseStatus{
+			Code:            0,
+			ResponseMessage: "ok",
+		},
+		Lsn: lsn,
+	}, nil
+}
+
+func (s *Server) Restore(ctx context.Context, in *proto.RestoreRequest) (*proto.RestoreResponse, error) {
+
+	if _, exist := s.databases[in.GetName()]; exist {
+		return nil, fmt.Errorf("database with name '%s' already exist", in.GetName())
+	}
+
+	// the archived records of the source database are replayed after the checkpoint
+	var archiver commitlog.Archiver
+	target := database.RestoreTarget{LSN: in.GetTargetLsn()}
+	if in.GetTargetTime() > 0 {
+		target.Time = time.Unix(0, in.GetTargetTime())
+	}
+
+	if in.GetSource() != "" {
+		var err error
+		if archiver, err = database.NewArchiver(in.GetSource(), s.Configuration.Database); err != nil {
+			return nil, fmt.Errorf("[Restore] error opening archive: %w", err)
+		}
+		if archiver == nil {
+			return nil, errors.New("archive mode is not enabled")
+		}
+	} else if target != (database.RestoreTarget{}) {
+		return nil, errors.New("a restore target requires a source database")
+	}
+
+	s.logger.Log(zapcore.InfoLevel, fmt.Sprintf("restoring database '%s' from '%s'", in.GetName(), in.GetPath()))
+	db, err := database.Restore(ctx, s.Configuration.Directory.Metadata, in.GetName(), in.GetPath(), archiver, target, s.Configuration.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	s.databases[db.Descriptor.Name] = db
+
+	if err = db.Start(); err != nil {
+		return nil, err
+	}
+
+	return &proto.RestoreResponse{
+		Code: &proto.ResponseStatus{
+			Code:            0,
+			ResponseMessage: "ok",
+		},
+	}, nil
+}
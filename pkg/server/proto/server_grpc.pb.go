@@ -25,6 +25,8 @@ type DatabaseManagerServiceClient interface {
 	CreateDatabase(ctx context.Context, in *CreateDatabaseRequest, opts ...grpc.CallOption) (*CreateDatabaseResponse, error)
 	StopDatabase(ctx context.Context, in *StopDatabaseRequest, opts ...grpc.CallOption) (*StopDatabaseResponse, error)
 	StartDatabase(ctx context.Context, in *StartDatabaseRequest, opts ...grpc.CallOption) (*StartDatabaseResponse, error)
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*BackupResponse, error)
+	Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error)
 }
 
 type databaseManagerServiceClient struct {
@@ -62,6 +64,24 @@ func (c *databaseManagerServiceClient) StartDatabase(ctx context.Context, in *St
 	return out, nil
 }
 
+func (c *databaseManagerServiceClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*BackupResponse, error) {
+	out := new(BackupResponse)
+	err := c.cc.Invoke(ctx, "/server.DatabaseManagerService/Backup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *databaseManagerServiceClient) Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error) {
+	out := new(RestoreResponse)
+	err := c.cc.Invoke(ctx, "/server.DatabaseManagerService/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DatabaseManagerServiceServer is the server API for DatabaseManagerService service.
 // All implementations must embed UnimplementedDatabaseManagerServiceServer
 // for forward compatibility
@@ -69,6 +89,8 @@ type DatabaseManagerServiceServer interface {
 	CreateDatabase(context.Context, *CreateDatabaseRequest) (*CreateDatabaseResponse, error)
 	StopDatabase(context.Context, *StopDatabaseRequest) (*StopDatabaseResponse, error)
 	StartDatabase(context.Context, *StartDatabaseRequest) (*StartDatabaseResponse, error)
+	Backup(context.Context, *BackupRequest) (*BackupResponse, error)
+	Restore(context.Context, *RestoreRequest) (*RestoreResponse, error)
 	mustEmbedUnimplementedDatabaseManagerServiceServer()
 }
 
@@ -85,6 +107,12 @@ func (UnimplementedDatabaseManagerServiceServer) StopDatabase(context.Context, *
 func (UnimplementedDatabaseManagerServiceServer) StartDatabase(context.Context, *StartDatabaseRequest) (*StartDatabaseResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StartDatabase not implemented")
 }
+func (UnimplementedDatabaseManagerServiceServer) Backup(context.Context, *BackupRequest) (*BackupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
+func (UnimplementedDatabaseManagerServiceServer) Restore(context.Context, *RestoreRequest) (*RestoreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
 func (UnimplementedDatabaseManagerServiceServer) mustEmbedUnimplementedDatabaseManagerServiceServer() {
 }
 
@@ -153,6 +181,42 @@ func _DatabaseManagerService_StartDatabase_Handler(srv interface{}, ctx context.
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DatabaseManagerService_Backup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DatabaseManagerServiceServer).Backup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/server.DatabaseManagerService/Backup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DatabaseManagerServiceServer).Backup(ctx, req.(*BackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DatabaseManagerService_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DatabaseManagerServiceServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/server.DatabaseManagerService/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DatabaseManagerServiceServer).Restore(ctx, req.(*RestoreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DatabaseManagerService_ServiceDesc is the grpc.ServiceDesc for DatabaseManagerService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -172,6 +236,14 @@ var DatabaseManagerService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "StartDatabase",
 			Handler:    _DatabaseManagerService_StartDatabase_Handler,
 		},
+		{
+			MethodName: "Backup",
+			Handler:    _DatabaseManagerService_Backup_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _DatabaseManagerService_Restore_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/server.proto",
@@ -12,6 +12,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/crikke/oi/pkg/database"
 	pb "github.com/crikke/oi/pkg/server/proto"
@@ -31,14 +32,21 @@ type ServerConfiguration struct {
 	}
 
 	Database database.Configuration
+
+	// How long a transaction may be idle before it is rolled back.
+	// defaults to 1m
+	TransactionTimeout time.Duration
 }
 
 type Server struct {
 	Configuration ServerConfiguration
 	databases     map[string]*database.Database
 	logger        *zap.Logger
+	// open transactions of the Database service
+	transactions *transactions
 
 	pb.UnimplementedDatabaseManagerServiceServer
+	pb.UnimplementedDatabaseServer
 }
 
 func NewServer(cfg ServerConfiguration) (*Server, error) {
@@ -54,9 +62,10 @@ func NewServer(cfg ServerConfiguration) (*Server, error) {
 	if err != nil {
 		panic(err)
 	}
-	s := &Server{logger: logger, Configuration: cfg}
+	s := &Server{logger: logger, Configuration: cfg, databases: make(map[string]*database.Database), transactions: newTransactions(cfg.TransactionTimeout)}
 	grpcServer := grpc.NewServer()
 	pb.RegisterDatabaseManagerServiceServer(grpcServer, s)
+	pb.RegisterDatabaseServer(grpcServer, s)
 	if err := grpcServer.Serve(lis); err != nil {
 		panic(err)
 	}
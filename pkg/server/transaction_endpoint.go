@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/crikke/oi/pkg/database"
+	"github.com/crikke/oi/pkg/server/proto"
+	"github.com/google/uuid"
+)
+
+// defaultTransactionTimeout is how long a transaction may be idle before it is rolled back
+const defaultTransactionTimeout = time.Minute
+
+// transactions holds the open transactions of the clients by id
+type transactions struct {
+	mu  sync.Mutex
+	txs map[string]*transaction
+	// transactions idle for longer than the timeout are rolled back, so a client which never commits does not pin a snapshot
+	timeout time.Duration
+}
+
+// transaction serializes the requests of a client to a transaction
+type transaction struct {
+	mu       sync.Mutex
+	database string
+	tx       *database.Transaction
+	// when the transaction was last used, guarded by transactions.mu
+	lastUsed time.Time
+}
+
+// newTransactions returns the transactions and starts rolling back the idle transactions in the background
+func newTransactions(timeout time.Duration) *transactions {
+
+	if timeout <= 0 {
+		timeout = defaultTransactionTimeout
+	}
+
+	t := &transactions{txs: make(map[string]*transaction), timeout: timeout}
+	go t.reapLoop()
+	return t
+}
+
+func (t *transactions) add(tx *transaction) string {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := uuid.NewString()
+	tx.lastUsed = time.Now()
+	t.txs[id] = tx
+	return id
+}
+
+// reapLoop periodically rolls back the transactions which have been idle for longer than the timeout
+func (t *transactions) reapLoop() {
+
+	ticker := time.NewTicker(t.timeout / 2)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		t.reap(now)
+	}
+}
+
+// reap removes the transactions idle since before now minus the timeout and releases their snapshots
+func (t *transactions) reap(now time.Time) {
+
+	t.mu.Lock()
+	expired := make([]*transaction, 0)
+	for id, tx := range t.txs {
+		if now.Sub(tx.lastUsed) > t.timeout {
+			expired = append(expired, tx)
+			delete(t.txs, id)
+		}
+	}
+	t.mu.Unlock()
+
+	// waits for a request which is still using the transaction
+	for _, tx := range expired {
+		tx.mu.Lock()
+		tx.tx.Rollback()
+		tx.mu.Unlock()
+	}
+}
+
+// get returns the transaction of the database with the id
+func (t *transactions) get(db, id string) (*transaction, error) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.txs[id]
+	if !ok || tx.database != db {
+		return nil, errors.New("transaction not found")
+	}
+	tx.lastUsed = time.Now()
+	return tx, nil
+}
+
+// remove returns the transaction and removes it, so it can no longer be used by other requests
+func (t *transactions) remove(db, id string) (*transaction, error) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.txs[id]
+	if !ok || tx.database != db {
+		return nil, errors.New("transaction not found")
+	}
+	delete(t.txs, id)
+	return tx, nil
+}
+
+func (s *Server) BeginTransaction(ctx context.Context, in *proto.BeginTransactionRequest) (*proto.BeginTransactionResponse, error) {
+
+	db, ok := s.databases[in.GetDatabase()]
+
+	if !ok {
+		return nil, errors.New("database not found")
+	}
+
+	id := s.transactions.add(&transaction{database: in.GetDatabase(), tx: db.BeginTx()})
+
+	return &proto.BeginTransactionResponse{
+		Status:      &proto.ResponseStatus{},
+		Transaction: id,
+	}, nil
+}
+
+func (s *Server) Commit(ctx context.Context, in *proto.CommitRequest) (*proto.ResponseStatus, error) {
+
+	tx, err := s.transactions.remove(in.GetDatabase(), in.GetTransaction())
+	if err != nil {
+		return nil, err
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if err := tx.tx.Commit(ctx); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			return &proto.ResponseStatus{Code: int32(proto.StatusCode_CONFLICT), ResponseMessage: err.Error()}, nil
+		}
+		return nil, err
+	}
+
+	return &proto.ResponseStatus{}, nil
+}
+
+func (s *Server) Rollback(ctx context.Context, in *proto.RollbackRequest) (*proto.ResponseStatus, error) {
+
+	tx, err := s.transactions.remove(in.GetDatabase(), in.GetTransaction())
+	if err != nil {
+		return nil, err
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.tx.Rollback()
+	return &proto.ResponseStatus{}, nil
+}
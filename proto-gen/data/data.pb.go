@@ -28,17 +28,25 @@ const (
 // log sequence number (LSN). The LSN is a 64bit unsigned integer which the first 32bits specify in which
 // log segment file the record exist and the last 32 bits specify the records index in the file.
 //
-// When persisting the record the checksum of the mutation is calculated and persisted aswell (CRC), in order
-// to ensure that the data is valid when replaying the records. The persisted checksum is compared to the
-// checksum of the data field
+// When persisting the record the checksum of the record is calculated and persisted aswell (CRC), in order
+// to ensure that the data is valid when replaying the records. The checksum covers the LSN, the timestamp and
+// the mutations of the record.
+//
+// A record either contains a single mutation in Data or a batch of mutations in Batch. The mutations of a batch
+// are written and replayed atomically, the checksum is calculated over all mutations in the batch.
 type Record struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	LSN      uint64    `protobuf:"varint,1,opt,name=LSN,proto3" json:"LSN,omitempty"`
-	Data     *Mutation `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
-	Checksum uint32    `protobuf:"varint,3,opt,name=Checksum,proto3" json:"Checksum,omitempty"`
+	LSN      uint64      `protobuf:"varint,1,opt,name=LSN,proto3" json:"LSN,omitempty"`
+	Data     *Mutation   `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	Checksum uint32      `protobuf:"varint,3,opt,name=Checksum,proto3" json:"Checksum,omitempty"`
+	Batch    []*Mutation `protobuf:"bytes,4,rep,name=Batch,proto3" json:"Batch,omitempty"`
+	// When the record was written, used to restore the database to a point in time
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	// Version of the checksum. Records written before version 1 have a checksum of the mutations only.
+	ChecksumVersion uint32 `protobuf:"varint,6,opt,name=ChecksumVersion,proto3" json:"ChecksumVersion,omitempty"`
 }
 
 func (x *Record) Reset() {
@@ -94,6 +102,27 @@ func (x *Record) GetChecksum() uint32 {
 	return 0
 }
 
+func (x *Record) GetBatch() []*Mutation {
+	if x != nil {
+		return x.Batch
+	}
+	return nil
+}
+
+func (x *Record) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Record) GetChecksumVersion() uint32 {
+	if x != nil {
+		return x.ChecksumVersion
+	}
+	return 0
+}
+
 type Mutation struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -102,6 +131,13 @@ type Mutation struct {
 	Key       []byte     `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
 	Value     []byte     `protobuf:"bytes,2,opt,name=Value,proto3" json:"Value,omitempty"`
 	Tombstone *Tombstone `protobuf:"bytes,3,opt,name=Tombstone,proto3" json:"Tombstone,omitempty"`
+	// If set the mutation deletes a range of keys, Key is the start of the range.
+	RangeTombstone *RangeTombstone `protobuf:"bytes,4,opt,name=RangeTombstone,proto3" json:"RangeTombstone,omitempty"`
+	// LSN of the record of the mutation. Versions of a key are ordered by sequence, the highest is the most recent.
+	// Assigned when the mutation is applied to the memtree.
+	Sequence uint64 `protobuf:"varint,5,opt,name=Sequence,proto3" json:"Sequence,omitempty"`
+	// If set the value expires at the time, expired values are not returned by reads and are turned into tombstones by compaction.
+	ExpireTime *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=ExpireTime,proto3" json:"ExpireTime,omitempty"`
 }
 
 func (x *Mutation) Reset() {
@@ -157,6 +193,27 @@ func (x *Mutation) GetTombstone() *Tombstone {
 	return nil
 }
 
+func (x *Mutation) GetRangeTombstone() *RangeTombstone {
+	if x != nil {
+		return x.RangeTombstone
+	}
+	return nil
+}
+
+func (x *Mutation) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Mutation) GetExpireTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpireTime
+	}
+	return nil
+}
+
 type Tombstone struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -204,6 +261,80 @@ func (x *Tombstone) GetDeletionTime() *timestamppb.Timestamp {
 	return nil
 }
 
+// RangeTombstone deletes all keys within [Start, End).
+type RangeTombstone struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Start        []byte                 `protobuf:"bytes,1,opt,name=Start,proto3" json:"Start,omitempty"`
+	End          []byte                 `protobuf:"bytes,2,opt,name=End,proto3" json:"End,omitempty"`
+	DeletionTime *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=DeletionTime,proto3" json:"DeletionTime,omitempty"`
+	// The range tombstone shadows versions with a lower sequence
+	Sequence uint64 `protobuf:"varint,4,opt,name=Sequence,proto3" json:"Sequence,omitempty"`
+}
+
+func (x *RangeTombstone) Reset() {
+	*x = RangeTombstone{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_data_data_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RangeTombstone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RangeTombstone) ProtoMessage() {}
+
+func (x *RangeTombstone) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_data_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RangeTombstone.ProtoReflect.Descriptor instead.
+func (*RangeTombstone) Descriptor() ([]byte, []int) {
+	return file_proto_data_data_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RangeTombstone) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *RangeTombstone) GetEnd() []byte {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *RangeTombstone) GetDeletionTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DeletionTime
+	}
+	return nil
+}
+
+func (x *RangeTombstone) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+// IndexEntry references a block of a SSTable, Key is the first key of the block.
 type IndexEntry struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -211,12 +342,14 @@ type IndexEntry struct {
 
 	Key      []byte `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
 	Position uint64 `protobuf:"varint,2,opt,name=Position,proto3" json:"Position,omitempty"`
+	// size of the block in bytes, including the trailer
+	Size uint64 `protobuf:"varint,3,opt,name=Size,proto3" json:"Size,omitempty"`
 }
 
 func (x *IndexEntry) Reset() {
 	*x = IndexEntry{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_proto_data_data_proto_msgTypes[3]
+		mi := &file_proto_data_data_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -229,7 +362,7 @@ func (x *IndexEntry) String() string {
 func (*IndexEntry) ProtoMessage() {}
 
 func (x *IndexEntry) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_data_data_proto_msgTypes[3]
+	mi := &file_proto_data_data_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -242,7 +375,7 @@ func (x *IndexEntry) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IndexEntry.ProtoReflect.Descriptor instead.
 func (*IndexEntry) Descriptor() ([]byte, []int) {
-	return file_proto_data_data_proto_rawDescGZIP(), []int{3}
+	return file_proto_data_data_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *IndexEntry) GetKey() []byte {
@@ -259,6 +392,310 @@ func (x *IndexEntry) GetPosition() uint64 {
 	return 0
 }
 
+func (x *IndexEntry) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+// TableMetadata describes a SSTable of the manifest
+type TableMetadata struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// name of the SSTable directory
+	Name  string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Level uint32 `protobuf:"varint,2,opt,name=Level,proto3" json:"Level,omitempty"`
+	// orders the SSTables of level 0, the highest generation is the most recent
+	Generation uint64 `protobuf:"varint,3,opt,name=Generation,proto3" json:"Generation,omitempty"`
+	// key range of the SSTable, including its range tombstones
+	Smallest    []byte `protobuf:"bytes,4,opt,name=Smallest,proto3" json:"Smallest,omitempty"`
+	Largest     []byte `protobuf:"bytes,5,opt,name=Largest,proto3" json:"Largest,omitempty"`
+	MaxSequence uint64 `protobuf:"varint,6,opt,name=MaxSequence,proto3" json:"MaxSequence,omitempty"`
+	Entries     uint64 `protobuf:"varint,7,opt,name=Entries,proto3" json:"Entries,omitempty"`
+	// size of the data file in bytes
+	Size        uint64 `protobuf:"varint,8,opt,name=Size,proto3" json:"Size,omitempty"`
+	MinSequence uint64 `protobuf:"varint,9,opt,name=MinSequence,proto3" json:"MinSequence,omitempty"`
+}
+
+func (x *TableMetadata) Reset() {
+	*x = TableMetadata{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_data_data_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TableMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TableMetadata) ProtoMessage() {}
+
+func (x *TableMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_data_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TableMetadata.ProtoReflect.Descriptor instead.
+func (*TableMetadata) Descriptor() ([]byte, []int) {
+	return file_proto_data_data_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TableMetadata) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *TableMetadata) GetLevel() uint32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *TableMetadata) GetGeneration() uint64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+func (x *TableMetadata) GetSmallest() []byte {
+	if x != nil {
+		return x.Smallest
+	}
+	return nil
+}
+
+func (x *TableMetadata) GetLargest() []byte {
+	if x != nil {
+		return x.Largest
+	}
+	return nil
+}
+
+func (x *TableMetadata) GetMaxSequence() uint64 {
+	if x != nil {
+		return x.MaxSequence
+	}
+	return 0
+}
+
+func (x *TableMetadata) GetEntries() uint64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *TableMetadata) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *TableMetadata) GetMinSequence() uint64 {
+	if x != nil {
+		return x.MinSequence
+	}
+	return 0
+}
+
+// TableProperties are the statistics of a SSTable, stored in properties.db of the SSTable
+type TableProperties struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// key range of the SSTable, including its range tombstones
+	Smallest        []byte `protobuf:"bytes,1,opt,name=Smallest,proto3" json:"Smallest,omitempty"`
+	Largest         []byte `protobuf:"bytes,2,opt,name=Largest,proto3" json:"Largest,omitempty"`
+	Entries         uint64 `protobuf:"varint,3,opt,name=Entries,proto3" json:"Entries,omitempty"`
+	RangeTombstones uint64 `protobuf:"varint,4,opt,name=RangeTombstones,proto3" json:"RangeTombstones,omitempty"`
+	// sequence range of the mutations and range tombstones
+	MinSequence uint64 `protobuf:"varint,5,opt,name=MinSequence,proto3" json:"MinSequence,omitempty"`
+	MaxSequence uint64 `protobuf:"varint,6,opt,name=MaxSequence,proto3" json:"MaxSequence,omitempty"`
+	DataBlocks  uint64 `protobuf:"varint,7,opt,name=DataBlocks,proto3" json:"DataBlocks,omitempty"`
+	// size in bytes of the uncompressed data blocks
+	RawDataSize uint64 `protobuf:"varint,8,opt,name=RawDataSize,proto3" json:"RawDataSize,omitempty"`
+	Compression string `protobuf:"bytes,9,opt,name=Compression,proto3" json:"Compression,omitempty"`
+	// name of the prefix extractor of the prefix filter, empty if the SSTable has no prefix filter
+	PrefixExtractor string `protobuf:"bytes,10,opt,name=PrefixExtractor,proto3" json:"PrefixExtractor,omitempty"`
+}
+
+func (x *TableProperties) Reset() {
+	*x = TableProperties{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_data_data_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TableProperties) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TableProperties) ProtoMessage() {}
+
+func (x *TableProperties) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_data_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TableProperties.ProtoReflect.Descriptor instead.
+func (*TableProperties) Descriptor() ([]byte, []int) {
+	return file_proto_data_data_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TableProperties) GetSmallest() []byte {
+	if x != nil {
+		return x.Smallest
+	}
+	return nil
+}
+
+func (x *TableProperties) GetLargest() []byte {
+	if x != nil {
+		return x.Largest
+	}
+	return nil
+}
+
+func (x *TableProperties) GetEntries() uint64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *TableProperties) GetRangeTombstones() uint64 {
+	if x != nil {
+		return x.RangeTombstones
+	}
+	return 0
+}
+
+func (x *TableProperties) GetMinSequence() uint64 {
+	if x != nil {
+		return x.MinSequence
+	}
+	return 0
+}
+
+func (x *TableProperties) GetMaxSequence() uint64 {
+	if x != nil {
+		return x.MaxSequence
+	}
+	return 0
+}
+
+func (x *TableProperties) GetDataBlocks() uint64 {
+	if x != nil {
+		return x.DataBlocks
+	}
+	return 0
+}
+
+func (x *TableProperties) GetRawDataSize() uint64 {
+	if x != nil {
+		return x.RawDataSize
+	}
+	return 0
+}
+
+func (x *TableProperties) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+func (x *TableProperties) GetPrefixExtractor() string {
+	if x != nil {
+		return x.PrefixExtractor
+	}
+	return ""
+}
+
+// VersionEdit is a record of the manifest. The deleted SSTables are removed before the added SSTables are added,
+// so a SSTable moved to another level is both deleted and added.
+type VersionEdit struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Added   []*TableMetadata `protobuf:"bytes,1,rep,name=Added,proto3" json:"Added,omitempty"`
+	Deleted []string         `protobuf:"bytes,2,rep,name=Deleted,proto3" json:"Deleted,omitempty"`
+}
+
+func (x *VersionEdit) Reset() {
+	*x = VersionEdit{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_data_data_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VersionEdit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionEdit) ProtoMessage() {}
+
+func (x *VersionEdit) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_data_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionEdit.ProtoReflect.Descriptor instead.
+func (*VersionEdit) Descriptor() ([]byte, []int) {
+	return file_proto_data_data_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *VersionEdit) GetAdded() []*TableMetadata {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *VersionEdit) GetDeleted() []string {
+	if x != nil {
+		return x.Deleted
+	}
+	return nil
+}
+
 var File_proto_data_data_proto protoreflect.FileDescriptor
 
 var file_proto_data_data_proto_rawDesc = []byte{
@@ -266,29 +703,102 @@ var file_proto_data_data_proto_rawDesc = []byte{
 	0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x6f, 0x69, 0x2e, 0x64, 0x61, 0x74, 0x61,
 	0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
 	0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x22, 0x5d, 0x0a, 0x06, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x4c,
-	0x53, 0x4e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x4c, 0x53, 0x4e, 0x12, 0x25, 0x0a,
-	0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6f, 0x69,
-	0x2e, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x04,
-	0x44, 0x61, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d,
-	0x22, 0x64, 0x0a, 0x08, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03,
-	0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4b, 0x65, 0x79, 0x12, 0x14,
-	0x0a, 0x05, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x56,
-	0x61, 0x6c, 0x75, 0x65, 0x12, 0x30, 0x0a, 0x09, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e,
-	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6f, 0x69, 0x2e, 0x64, 0x61, 0x74,
-	0x61, 0x2e, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x52, 0x09, 0x54, 0x6f, 0x6d,
-	0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x22, 0x4b, 0x0a, 0x09, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74,
-	0x6f, 0x6e, 0x65, 0x12, 0x3e, 0x0a, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x69, 0x6f, 0x6e, 0x54,
-	0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
-	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
-	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x69, 0x6f, 0x6e, 0x54,
-	0x69, 0x6d, 0x65, 0x22, 0x3a, 0x0a, 0x0a, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x45, 0x6e, 0x74, 0x72,
-	0x79, 0x12, 0x10, 0x0a, 0x03, 0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03,
-	0x4b, 0x65, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x42,
-	0x10, 0x5a, 0x0e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2d, 0x67, 0x65, 0x6e, 0x2f, 0x64, 0x61, 0x74,
-	0x61, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6f, 0x22, 0xea, 0x01, 0x0a, 0x06, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x10, 0x0a, 0x03,
+	0x4c, 0x53, 0x4e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x4c, 0x53, 0x4e, 0x12, 0x25,
+	0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6f,
+	0x69, 0x2e, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75,
+	0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75,
+	0x6d, 0x12, 0x27, 0x0a, 0x05, 0x42, 0x61, 0x74, 0x63, 0x68, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x6f, 0x69, 0x2e, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x4d, 0x75, 0x74, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x05, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x38, 0x0a, 0x09, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x54, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x12, 0x28, 0x0a, 0x0f, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x43,
+	0x68, 0x65, 0x63, 0x6b, 0x73, 0x75, 0x6d, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0xfd,
+	0x01, 0x0a, 0x08, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x4b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4b, 0x65, 0x79, 0x12, 0x14, 0x0a,
+	0x05, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x56, 0x61,
+	0x6c, 0x75, 0x65, 0x12, 0x30, 0x0a, 0x09, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6f, 0x69, 0x2e, 0x64, 0x61, 0x74, 0x61,
+	0x2e, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x52, 0x09, 0x54, 0x6f, 0x6d, 0x62,
+	0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x3f, 0x0a, 0x0e, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f,
+	0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e,
+	0x6f, 0x69, 0x2e, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d,
+	0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x52, 0x0e, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d,
+	0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x53, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x53, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x12, 0x3a, 0x0a, 0x0a, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x52, 0x0a, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x22, 0x4b,
+	0x0a, 0x09, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x3e, 0x0a, 0x0c, 0x44,
+	0x65, 0x6c, 0x65, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0c, 0x44,
+	0x65, 0x6c, 0x65, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x22, 0x94, 0x01, 0x0a, 0x0e,
+	0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x53, 0x74, 0x61, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x53,
+	0x74, 0x61, 0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x45, 0x6e, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x03, 0x45, 0x6e, 0x64, 0x12, 0x3e, 0x0a, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x69,
+	0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x69,
+	0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x53, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x53, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x22, 0x4e, 0x0a, 0x0a, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4b,
+	0x65, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12,
+	0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x53, 0x69,
+	0x7a, 0x65, 0x22, 0x81, 0x02, 0x0a, 0x0d, 0x54, 0x61, 0x62, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61,
+	0x64, 0x61, 0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x4c, 0x65, 0x76, 0x65,
+	0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x4c, 0x65, 0x76, 0x65, 0x6c, 0x12, 0x1e,
+	0x0a, 0x0a, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x0a, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a,
+	0x0a, 0x08, 0x53, 0x6d, 0x61, 0x6c, 0x6c, 0x65, 0x73, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x08, 0x53, 0x6d, 0x61, 0x6c, 0x6c, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x4c, 0x61,
+	0x72, 0x67, 0x65, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x4c, 0x61, 0x72,
+	0x67, 0x65, 0x73, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x4d, 0x61, 0x78, 0x53, 0x65, 0x71, 0x75, 0x65,
+	0x6e, 0x63, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x4d, 0x61, 0x78, 0x53, 0x65,
+	0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65,
+	0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73,
+	0x12, 0x12, 0x0a, 0x04, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04,
+	0x53, 0x69, 0x7a, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x4d, 0x69, 0x6e, 0x53, 0x65, 0x71, 0x75, 0x65,
+	0x6e, 0x63, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x4d, 0x69, 0x6e, 0x53, 0x65,
+	0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x22, 0xdd, 0x02, 0x0a, 0x0f, 0x54, 0x61, 0x62, 0x6c, 0x65,
+	0x50, 0x72, 0x6f, 0x70, 0x65, 0x72, 0x74, 0x69, 0x65, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x53, 0x6d,
+	0x61, 0x6c, 0x6c, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x53, 0x6d,
+	0x61, 0x6c, 0x6c, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x4c, 0x61, 0x72, 0x67, 0x65, 0x73,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x4c, 0x61, 0x72, 0x67, 0x65, 0x73, 0x74,
+	0x12, 0x18, 0x0a, 0x07, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x07, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x12, 0x28, 0x0a, 0x0f, 0x52, 0x61,
+	0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x73, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x0f, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74,
+	0x6f, 0x6e, 0x65, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x4d, 0x69, 0x6e, 0x53, 0x65, 0x71, 0x75, 0x65,
+	0x6e, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x4d, 0x69, 0x6e, 0x53, 0x65,
+	0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x4d, 0x61, 0x78, 0x53, 0x65, 0x71,
+	0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x4d, 0x61, 0x78,
+	0x53, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x44, 0x61, 0x74, 0x61,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x44, 0x61,
+	0x74, 0x61, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x52, 0x61, 0x77, 0x44,
+	0x61, 0x74, 0x61, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x52,
+	0x61, 0x77, 0x44, 0x61, 0x74, 0x61, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f,
+	0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x0f,
+	0x50, 0x72, 0x65, 0x66, 0x69, 0x78, 0x45, 0x78, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x50, 0x72, 0x65, 0x66, 0x69, 0x78, 0x45, 0x78, 0x74,
+	0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x22, 0x55, 0x0a, 0x0b, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x45, 0x64, 0x69, 0x74, 0x12, 0x2c, 0x0a, 0x05, 0x41, 0x64, 0x64, 0x65, 0x64, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x6f, 0x69, 0x2e, 0x64, 0x61, 0x74, 0x61, 0x2e, 0x54,
+	0x61, 0x62, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x05, 0x41, 0x64,
+	0x64, 0x65, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x42, 0x10, 0x5a,
+	0x0e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2d, 0x67, 0x65, 0x6e, 0x2f, 0x64, 0x61, 0x74, 0x61, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -303,23 +813,33 @@ func file_proto_data_data_proto_rawDescGZIP() []byte {
 	return file_proto_data_data_proto_rawDescData
 }
 
-var file_proto_data_data_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_data_data_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_proto_data_data_proto_goTypes = []interface{}{
 	(*Record)(nil),                // 0: oi.data.Record
 	(*Mutation)(nil),              // 1: oi.data.Mutation
 	(*Tombstone)(nil),             // 2: oi.data.Tombstone
-	(*IndexEntry)(nil),            // 3: oi.data.IndexEntry
-	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+	(*RangeTombstone)(nil),        // 3: oi.data.RangeTombstone
+	(*IndexEntry)(nil),            // 4: oi.data.IndexEntry
+	(*TableMetadata)(nil),         // 5: oi.data.TableMetadata
+	(*TableProperties)(nil),       // 6: oi.data.TableProperties
+	(*VersionEdit)(nil),           // 7: oi.data.VersionEdit
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
 }
 var file_proto_data_data_proto_depIdxs = []int32{
 	1, // 0: oi.data.Record.Data:type_name -> oi.data.Mutation
-	2, // 1: oi.data.Mutation.Tombstone:type_name -> oi.data.Tombstone
-	4, // 2: oi.data.Tombstone.DeletionTime:type_name -> google.protobuf.Timestamp
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	1, // 1: oi.data.Record.Batch:type_name -> oi.data.Mutation
+	8, // 2: oi.data.Record.Timestamp:type_name -> google.protobuf.Timestamp
+	2, // 3: oi.data.Mutation.Tombstone:type_name -> oi.data.Tombstone
+	3, // 4: oi.data.Mutation.RangeTombstone:type_name -> oi.data.RangeTombstone
+	8, // 5: oi.data.Mutation.ExpireTime:type_name -> google.protobuf.Timestamp
+	8, // 6: oi.data.Tombstone.DeletionTime:type_name -> google.protobuf.Timestamp
+	8, // 7: oi.data.RangeTombstone.DeletionTime:type_name -> google.protobuf.Timestamp
+	5, // 8: oi.data.VersionEdit.Added:type_name -> oi.data.TableMetadata
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_proto_data_data_proto_init() }
@@ -365,6 +885,18 @@ func file_proto_data_data_proto_init() {
 			}
 		}
 		file_proto_data_data_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RangeTombstone); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_data_data_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*IndexEntry); i {
 			case 0:
 				return &v.state
@@ -376,6 +908,42 @@ func file_proto_data_data_proto_init() {
 				return nil
 			}
 		}
+		file_proto_data_data_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TableMetadata); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_data_data_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TableProperties); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_data_data_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VersionEdit); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -383,7 +951,7 @@ func file_proto_data_data_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_data_data_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   0,
 		},